@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/EduardoMark/gastro-api/internal/broker"
+	"github.com/EduardoMark/gastro-api/internal/categories"
 	"github.com/EduardoMark/gastro-api/internal/config"
 	"github.com/EduardoMark/gastro-api/internal/database"
 	"github.com/EduardoMark/gastro-api/internal/dishes"
+	"github.com/EduardoMark/gastro-api/internal/health"
+	"github.com/EduardoMark/gastro-api/internal/kitchen"
+	"github.com/EduardoMark/gastro-api/internal/mailer"
 	appmw "github.com/EduardoMark/gastro-api/internal/middleware"
 	"github.com/EduardoMark/gastro-api/internal/order"
 	"github.com/EduardoMark/gastro-api/internal/users"
@@ -18,52 +29,195 @@ import (
 )
 
 func main() {
-	env := config.Load()
+	cfg, args, err := config.Load("api", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Log.Configure()
+
+	// "api config" prints the effective configuration without its secrets.
+	if len(args) > 0 && args[0] == "config" {
+		if err := cfg.Redacted().WriteYAML(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	db, err := database.New(env)
+	db, err := database.New(cfg.Database)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := database.Migrate(db); err != nil {
-		log.Fatalf("failed to running migrate: %v", err)
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := database.RunMigrateCommand(context.Background(), db, args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	authService := auth.NewAuthJWTService(env)
-	jwtMiddleware := appmw.NewJWTMiddleware(authService)
+	if err := checkMigrations(db, cfg.Features.MigrateOnStart); err != nil {
+		log.Fatal(err)
+	}
+
+	authService, err := auth.NewAuthJWTService(cfg.Auth)
+	if err != nil {
+		log.Fatalf("failed to load JWT keys: %v", err)
+	}
+	go reloadKeysOnHangup(authService)
 
 	userRepo := users.NewUserRepo(db)
-	userService := users.NewUserService(userRepo)
+	orderRepo := order.NewOrderRepository(db)
+	signer, err := auth.NewEmailSigner(cfg.Auth)
+	if err != nil {
+		log.Fatalf("failed to create email token signer: %v", err)
+	}
+
+	userService := users.NewUserService(userRepo, orderRepo, mailer.New(cfg.Mail), signer, cfg.AppURL)
+	jwtMiddleware := appmw.NewJWTMiddleware(authService, userService, userService, cfg.Auth.TwoFactorRoles)
+
+	if cfg.Bootstrap.AdminEmail != "" {
+		created, err := userService.BootstrapAdmin(
+			context.Background(),
+			cfg.Bootstrap.AdminName,
+			cfg.Bootstrap.AdminEmail,
+			cfg.Bootstrap.AdminPassword,
+		)
+		if err != nil {
+			log.Fatalf("failed to bootstrap admin: %v", err)
+		}
+		if created {
+			log.Printf("bootstrap admin %s created", cfg.Bootstrap.AdminEmail)
+		}
+	}
+
 	userHandler := users.NerUserHandler(userService, jwtMiddleware, authService)
 
+	categoryRepo := categories.NewCategoryRepository(db)
+	categoryService := categories.NewCategoryService(categoryRepo)
+	categoryHandler := categories.NewCategoryHandler(categoryService, jwtMiddleware)
+
 	dishRepo := dishes.NewDishRepository(db)
-	dishService := dishes.NewDishService(dishRepo)
+	dishService := dishes.NewDishService(dishRepo, categoryRepo)
 	dishHandler := dishes.NewDishHandler(dishService, jwtMiddleware)
 
-	orderRepo := order.NewOrderRepository(db)
-	orderService := order.NewOrderService(orderRepo, dishRepo)
+	eventBroker := broker.New()
+
+	orderService := order.NewOrderService(orderRepo, eventBroker, userService)
 	orderHandler := order.NewOrderHandler(orderService, *jwtMiddleware)
 
+	kitchenHandler := kitchen.NewKitchenHandler(eventBroker, jwtMiddleware)
+
+	healthHandler := health.NewHealthHandler()
+	healthHandler.AddCheck("database", health.DatabaseCheck(db))
+	healthHandler.AddCheck("migrations", health.MigrationsCheck(db))
+	healthHandler.AddCheck("event_broker", health.BrokerCheck(eventBroker))
+
 	router := chi.NewRouter()
+	router.Get("/.well-known/jwks.json", authService.JWKSHandler)
+	healthHandler.HealthRoutes(router)
+
 	router.Route("/api/v1", func(r chi.Router) {
 		r.Use(middleware.Logger)
 		r.Use(middleware.Recoverer)
+		r.Use(appmw.MaxBodySize(cfg.Server.MaxBodyBytes))
 
 		userHandler.UserRoutes(r)
+		categoryHandler.CategoryRoutes(r)
 		dishHandler.DishRoutes(r)
 		orderHandler.OrderRoutes(r)
+		kitchenHandler.KitchenRoutes(r)
 	})
 
-	server := http.Server{
-		Addr:              ":3000",
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
 		Handler:           router,
-		ReadTimeout:       10 * time.Second,
-		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      10 * time.Second,
-		IdleTimeout:       time.Minute,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatal(err)
+	// Closing the broker ends the kitchen event streams, which would
+	// otherwise keep the drain waiting until the deadline.
+	server.RegisterOnShutdown(eventBroker.Close)
+
+	serveErr := serve(server, cfg.Server, healthHandler.Drain)
+
+	eventBroker.Close()
+
+	// No request is left to queue password reset emails; send the queued
+	// ones before the database goes away.
+	closeCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := userService.Close(closeCtx); err != nil {
+		log.Printf("failed to send queued emails: %v", err)
+	}
+	cancel()
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("failed to close database: %v", err)
+		}
+	}
+
+	// Exit non-zero so the orchestrator sees a failed start, such as the
+	// port being in use, or a drain that hit its deadline.
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
+}
+
+// serve runs server until SIGINT or SIGTERM. It then calls drain, which fails
+// the readiness probe, keeps serving for cfg.ShutdownDelay so load balancers
+// notice, stops accepting connections and lets in-flight requests finish for
+// up to cfg.ShutdownTimeout before closing them.
+func serve(server *http.Server, cfg config.Server, drain func()) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", server.Addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	stop()
+	drain()
+	log.Printf("shutting down in %s, draining requests for up to %s", cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("failed to drain requests: %v", err)
+	}
+
+	return nil
+}
+
+// reloadKeysOnHangup reloads the JWT keys on SIGHUP so keys can be rotated
+// without restarting the server.
+func reloadKeysOnHangup(authService *auth.AuthJWTService) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		if err := authService.Reload(); err != nil {
+			log.Printf("failed to reload JWT keys, keeping the current ones: %v", err)
+		}
 	}
 }
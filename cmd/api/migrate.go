@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/EduardoMark/gastro-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// checkMigrations makes sure the schema matches this build before serving.
+// Pending migrations are applied when apply is set; otherwise the server
+// refuses to start, so schema changes stay a deliberate step.
+func checkMigrations(db *gorm.DB, apply bool) error {
+	pending, err := database.Pending(context.Background(), db)
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %v", err)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if !apply {
+		return fmt.Errorf("%d pending migrations, run \"migrate up\" or set MIGRATE_ON_START=true", len(pending))
+	}
+
+	applied, err := database.MigrateUp(context.Background(), db)
+	for _, m := range applied {
+		log.Printf("applied migration %d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply migrations: %v", err)
+	}
+
+	return nil
+}
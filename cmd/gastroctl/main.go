@@ -0,0 +1,158 @@
+// Command gastroctl runs maintenance tasks against the database without the
+// HTTP server: creating admins, resetting passwords, importing and exporting
+// the menu, seeding demo data and migrating the schema.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/EduardoMark/gastro-api/internal/categories"
+	"github.com/EduardoMark/gastro-api/internal/config"
+	"github.com/EduardoMark/gastro-api/internal/database"
+	"github.com/EduardoMark/gastro-api/internal/dishes"
+	"github.com/EduardoMark/gastro-api/internal/mailer"
+	"github.com/EduardoMark/gastro-api/internal/order"
+	"github.com/EduardoMark/gastro-api/internal/users"
+	"golang.org/x/term"
+	"gorm.io/gorm"
+)
+
+const usage = `usage: gastroctl [-config FILE] [flags] <command> [arguments]
+
+commands:
+  user create-admin -name NAME -email EMAIL [-password PASSWORD]
+  user reset-password -email EMAIL [-password PASSWORD]
+  menu export [-o FILE]
+  menu import -f FILE
+  seed demo [-password PASSWORD]
+  migrate up | down [steps] | status
+  config
+
+Run "gastroctl -h" for the configuration flags.
+
+Passwords not given as flags are read from standard input.`
+
+var errUsage = errors.New(usage)
+
+// app holds the services the commands share. They are the same services the
+// HTTP server uses, so the same rules apply.
+type app struct {
+	users      users.Service
+	categories categories.Service
+	dishes     dishes.Service
+}
+
+func main() {
+	err := run(context.Background(), os.Args[1:])
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	cfg, args, err := config.Load("gastroctl", args)
+	if err != nil {
+		return err
+	}
+	cfg.Log.Configure()
+
+	if len(args) == 0 || args[0] == "help" {
+		return errUsage
+	}
+
+	if args[0] == "config" {
+		return cfg.Redacted().WriteYAML(os.Stdout)
+	}
+
+	db, err := database.New(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "migrate" {
+		return database.RunMigrateCommand(ctx, db, args[1:], os.Stdout)
+	}
+
+	pending, err := database.Pending(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %v", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, run \"gastroctl migrate up\" first", len(pending))
+	}
+
+	a, err := newApp(cfg, db)
+	if err != nil {
+		return err
+	}
+	defer a.users.Close(ctx)
+
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	switch args[0] + " " + args[1] {
+	case "user create-admin":
+		return a.createAdmin(ctx, args[2:])
+	case "user reset-password":
+		return a.resetPassword(ctx, args[2:])
+	case "menu export":
+		return a.exportMenu(ctx, args[2:])
+	case "menu import":
+		return a.importMenu(ctx, args[2:])
+	case "seed demo":
+		return a.seedDemo(ctx, args[2:])
+	}
+
+	return errUsage
+}
+
+func newApp(cfg *config.Config, db *gorm.DB) (*app, error) {
+	signer, err := auth.NewEmailSigner(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email token signer: %v", err)
+	}
+
+	categoryRepo := categories.NewCategoryRepository(db)
+
+	return &app{
+		users:      users.NewUserService(users.NewUserRepo(db), order.NewOrderRepository(db), mailer.New(cfg.Mail), signer, cfg.AppURL),
+		categories: categories.NewCategoryService(categoryRepo),
+		dishes:     dishes.NewDishService(dishes.NewDishRepository(db), categoryRepo),
+	}, nil
+}
+
+// readPassword returns value, or a line read from standard input when value
+// is empty, so passwords do not have to show up in the shell history. The
+// password is not echoed when standard input is a terminal.
+func readPassword(value string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		pass, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %v", err)
+		}
+		return string(pass), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/EduardoMark/gastro-api/internal/categories"
+	"github.com/EduardoMark/gastro-api/internal/dishes"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Menu is the file format of menu import and export. Categories and dishes
+// refer to their category by path, such as "Bebidas > Sucos", so a file can be
+// moved between databases. A bare name is accepted when only one category has
+// it.
+type Menu struct {
+	Categories []MenuCategory `json:"categories"`
+	Dishes     []MenuDish     `json:"dishes"`
+}
+
+type MenuCategory struct {
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+	Parent   string `json:"parent,omitempty"`
+}
+
+type MenuDish struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       decimal.Decimal `json:"price"`
+	Category    string          `json:"category"`
+	Available   *bool           `json:"available,omitempty"`
+}
+
+func (a *app) exportMenu(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("menu export", flag.ContinueOnError)
+	output := fs.String("o", "", "file to write, standard output by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	menu, err := a.loadMenu(ctx)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(menu)
+}
+
+func (a *app) importMenu(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("menu import", flag.ContinueOnError)
+	file := fs.String("f", "", "menu file to import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return errors.New("field f is required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", *file, err)
+	}
+
+	var menu Menu
+	if err := json.Unmarshal(data, &menu); err != nil {
+		return fmt.Errorf("invalid menu file: %v", err)
+	}
+
+	return a.applyMenu(ctx, menu)
+}
+
+// loadMenu reads every category and dish. Parents come before their
+// sub-categories so the result can be imported in order.
+func (a *app) loadMenu(ctx context.Context) (*Menu, error) {
+	records, err := a.categories.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := newCategoryIndex(records)
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return len(index.ancestors(records[i])) < len(index.ancestors(records[j]))
+	})
+
+	menu := &Menu{Categories: []MenuCategory{}, Dishes: []MenuDish{}}
+	for _, c := range records {
+		item := MenuCategory{Name: c.Name, Position: c.Position}
+		if c.ParentID != nil && index.byID[*c.ParentID] != nil {
+			item.Parent = index.path(index.byID[*c.ParentID])
+		}
+		menu.Categories = append(menu.Categories, item)
+	}
+
+	all, err := a.allDishes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range all {
+		category := d.Category
+		if d.CategoryID != nil && index.byID[*d.CategoryID] != nil {
+			category = index.path(index.byID[*d.CategoryID])
+		}
+
+		available := d.Available
+		menu.Dishes = append(menu.Dishes, MenuDish{
+			Name:        d.Name,
+			Description: d.Description,
+			Price:       d.Price,
+			Category:    category,
+			Available:   &available,
+		})
+	}
+
+	return menu, nil
+}
+
+// applyMenu creates the categories that do not exist yet, matched by slug
+// under the same parent, and creates or updates dishes matched by name.
+// Dishes missing from the menu are left alone, so importing never deletes
+// anything.
+func (a *app) applyMenu(ctx context.Context, menu Menu) error {
+	records, err := a.categories.Query(ctx)
+	if err != nil {
+		return err
+	}
+
+	index := newCategoryIndex(records)
+
+	var createdCategories, createdDishes, updatedDishes int
+
+	for _, item := range menu.Categories {
+		var parent *categories.Category
+		if item.Parent != "" {
+			parent, err = index.find(item.Parent)
+			if errors.Is(err, errCategoryNotFound) {
+				return fmt.Errorf("category %q: parent %q must be listed before it", item.Name, item.Parent)
+			}
+			if err != nil {
+				return fmt.Errorf("category %q: parent %v", item.Name, err)
+			}
+		}
+
+		if index.child(parent, categories.Slugify(item.Name)) != nil {
+			continue
+		}
+
+		req := categories.CreateRequest{Name: item.Name, Position: item.Position}
+		if parent != nil {
+			parentID := parent.ID.String()
+			req.ParentID = &parentID
+		}
+
+		if err := req.Validate(); err != nil {
+			return fmt.Errorf("category %q: %v", item.Name, err)
+		}
+
+		created, err := a.categories.Create(ctx, req)
+		if err != nil {
+			return fmt.Errorf("category %q: %v", item.Name, err)
+		}
+
+		index.add(created)
+		createdCategories++
+	}
+
+	existing, err := a.dishesByName(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range menu.Dishes {
+		category, err := index.find(item.Category)
+		if err != nil {
+			return fmt.Errorf("dish %q: %v", item.Name, err)
+		}
+
+		req := dishes.UpdateRequest{
+			Name:        item.Name,
+			Description: item.Description,
+			Price:       item.Price.InexactFloat64(),
+			CategoryID:  category.ID.String(),
+		}
+		if err := req.Validate(); err != nil {
+			return fmt.Errorf("dish %q: %v", item.Name, err)
+		}
+
+		if dish, ok := existing[item.Name]; ok {
+			if err := a.dishes.Update(ctx, dish.ID, req); err != nil {
+				return fmt.Errorf("dish %q: %v", item.Name, err)
+			}
+			updatedDishes++
+			continue
+		}
+
+		if _, err := a.dishes.Create(ctx, req.Name, req.Description, category.ID, req.Price); err != nil {
+			return fmt.Errorf("dish %q: %v", item.Name, err)
+		}
+		createdDishes++
+	}
+
+	// Availability is applied once every dish exists, to created and updated
+	// dishes alike.
+	existing, err = a.dishesByName(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range menu.Dishes {
+		dish, ok := existing[item.Name]
+		if !ok || item.Available == nil || dish.Available == *item.Available {
+			continue
+		}
+
+		if err := a.dishes.SetAvailability(ctx, dish.ID, *item.Available); err != nil {
+			return fmt.Errorf("dish %q: %v", item.Name, err)
+		}
+	}
+
+	fmt.Printf("%d categories created, %d dishes created, %d dishes updated\n",
+		createdCategories, createdDishes, updatedDishes)
+	return nil
+}
+
+func (a *app) allDishes(ctx context.Context) ([]*dishes.Dish, error) {
+	var all []*dishes.Dish
+
+	for page := 1; ; page++ {
+		records, total, err := a.dishes.Query(ctx, dishes.QueryFilter{Page: page, Limit: dishes.MaxPageLimit})
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, records...)
+		if len(records) == 0 || int64(len(all)) >= total {
+			return all, nil
+		}
+	}
+}
+
+func (a *app) dishesByName(ctx context.Context) (map[string]*dishes.Dish, error) {
+	all, err := a.allDishes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*dishes.Dish, len(all))
+	for _, d := range all {
+		byName[d.Name] = d
+	}
+
+	return byName, nil
+}
+
+// categoryPathSeparator separates the names of a category path, such as
+// "Bebidas > Sucos".
+const categoryPathSeparator = " > "
+
+var errCategoryNotFound = errors.New("category not found")
+
+// categoryIndex finds categories by the path the menu file refers to them
+// with. Slugs are only unique among siblings, so categories are keyed by the
+// slugs of their ancestors and their own.
+type categoryIndex struct {
+	byID   map[uuid.UUID]*categories.Category
+	byKey  map[string]*categories.Category
+	bySlug map[string][]*categories.Category
+}
+
+func newCategoryIndex(records []*categories.Category) *categoryIndex {
+	index := &categoryIndex{
+		byID:   make(map[uuid.UUID]*categories.Category, len(records)),
+		byKey:  make(map[string]*categories.Category, len(records)),
+		bySlug: make(map[string][]*categories.Category, len(records)),
+	}
+
+	for _, c := range records {
+		index.byID[c.ID] = c
+	}
+	for _, c := range records {
+		index.add(c)
+	}
+
+	return index
+}
+
+// add indexes c, whose parent must already be indexed.
+func (ix *categoryIndex) add(c *categories.Category) {
+	ix.byID[c.ID] = c
+	ix.byKey[ix.key(c)] = c
+	ix.bySlug[c.Slug] = append(ix.bySlug[c.Slug], c)
+}
+
+// ancestors returns the parents of c, the root first.
+func (ix *categoryIndex) ancestors(c *categories.Category) []*categories.Category {
+	var chain []*categories.Category
+	for c.ParentID != nil && ix.byID[*c.ParentID] != nil && len(chain) < len(ix.byID) {
+		c = ix.byID[*c.ParentID]
+		chain = append([]*categories.Category{c}, chain...)
+	}
+	return chain
+}
+
+func (ix *categoryIndex) key(c *categories.Category) string {
+	var slugs []string
+	for _, a := range ix.ancestors(c) {
+		slugs = append(slugs, a.Slug)
+	}
+	return strings.Join(append(slugs, c.Slug), "/")
+}
+
+// path returns the names of the ancestors of c and its own, such as
+// "Bebidas > Sucos".
+func (ix *categoryIndex) path(c *categories.Category) string {
+	var names []string
+	for _, a := range ix.ancestors(c) {
+		names = append(names, a.Name)
+	}
+	return strings.Join(append(names, c.Name), categoryPathSeparator)
+}
+
+// child returns the child of parent with slug, or the root category with slug
+// when parent is nil.
+func (ix *categoryIndex) child(parent *categories.Category, slug string) *categories.Category {
+	if parent == nil {
+		return ix.byKey[slug]
+	}
+	return ix.byKey[ix.key(parent)+"/"+slug]
+}
+
+// find resolves ref, either a path such as "Bebidas > Sucos" or a name that
+// only one category has.
+func (ix *categoryIndex) find(ref string) (*categories.Category, error) {
+	parts := strings.Split(ref, strings.TrimSpace(categoryPathSeparator))
+	if len(parts) > 1 {
+		slugs := make([]string, len(parts))
+		for i, part := range parts {
+			slugs[i] = categories.Slugify(part)
+		}
+
+		if c, ok := ix.byKey[strings.Join(slugs, "/")]; ok {
+			return c, nil
+		}
+		return nil, fmt.Errorf("%w: %q", errCategoryNotFound, ref)
+	}
+
+	matches := ix.bySlug[categories.Slugify(ref)]
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %q", errCategoryNotFound, ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("category %q is ambiguous, refer to it by path such as %q", ref, ix.path(matches[0]))
+	}
+}
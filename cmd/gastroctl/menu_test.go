@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/categories"
+	"github.com/google/uuid"
+)
+
+func TestCategoryIndex(t *testing.T) {
+	newCategory := func(name string, parent *categories.Category) *categories.Category {
+		c := &categories.Category{ID: uuid.New(), Name: name, Slug: categories.Slugify(name)}
+		if parent != nil {
+			c.ParentID = &parent.ID
+		}
+		return c
+	}
+
+	drinks := newCategory("Bebidas", nil)
+	desserts := newCategory("Sobremesas", nil)
+	juices := newCategory("Sucos", drinks)
+	dessertJuices := newCategory("Sucos", desserts)
+	sodas := newCategory("Refrigerantes", drinks)
+
+	index := newCategoryIndex([]*categories.Category{juices, dessertJuices, sodas, drinks, desserts})
+
+	t.Run("should find a category by path", func(t *testing.T) {
+		c, err := index.find("Sobremesas > Sucos")
+		if err != nil || c != dessertJuices {
+			t.Errorf("expected the juices under desserts, got %+v, %v", c, err)
+		}
+	})
+
+	t.Run("should find a category by a name only it has", func(t *testing.T) {
+		c, err := index.find("refrigerantes")
+		if err != nil || c != sodas {
+			t.Errorf("expected sodas, got %+v, %v", c, err)
+		}
+	})
+
+	t.Run("should reject an ambiguous name", func(t *testing.T) {
+		if _, err := index.find("Sucos"); err == nil || errors.Is(err, errCategoryNotFound) {
+			t.Errorf("expected an ambiguity error, got %v", err)
+		}
+	})
+
+	t.Run("should report unknown categories", func(t *testing.T) {
+		for _, ref := range []string{"Entradas", "Entradas > Sucos"} {
+			if _, err := index.find(ref); !errors.Is(err, errCategoryNotFound) {
+				t.Errorf("%s: expected errCategoryNotFound, got %v", ref, err)
+			}
+		}
+	})
+
+	t.Run("should look children up under their parent", func(t *testing.T) {
+		if c := index.child(desserts, "sucos"); c != dessertJuices {
+			t.Errorf("expected the juices under desserts, got %+v", c)
+		}
+		if c := index.child(nil, "sucos"); c != nil {
+			t.Errorf("expected no root category, got %+v", c)
+		}
+	})
+
+	t.Run("should build paths for export", func(t *testing.T) {
+		if path := index.path(juices); path != "Bebidas > Sucos" {
+			t.Errorf("expected Bebidas > Sucos, got %q", path)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/EduardoMark/gastro-api/internal/users"
+)
+
+//go:embed demo_menu.json
+var demoMenu []byte
+
+// demoRoles are the accounts created by seed demo, one per role, with
+// emails such as manager@demo.gastro-api.local.
+var demoRoles = []users.Role{
+	users.RoleManager,
+	users.RoleKitchen,
+	users.RoleWaiter,
+	users.RoleCashier,
+	users.RoleClient,
+}
+
+// seedDemo loads a demo menu and one account per staff role plus a client,
+// all sharing one password. It can be run again: existing categories,
+// dishes and accounts are kept. The accounts still have to verify their
+// email, which the log mailer prints in development.
+func (a *app) seedDemo(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed demo", flag.ContinueOnError)
+	password := fs.String("password", "", "password of the demo accounts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	var menu Menu
+	if err := json.Unmarshal(demoMenu, &menu); err != nil {
+		return fmt.Errorf("invalid demo menu: %v", err)
+	}
+
+	if err := a.applyMenu(ctx, menu); err != nil {
+		return err
+	}
+
+	for _, role := range demoRoles {
+		req := users.SignupRequest{
+			Name:     "Demo " + strings.ToUpper(string(role[:1])) + string(role[1:]),
+			Email:    string(role) + "@demo.gastro-api.local",
+			Password: pass,
+		}
+		if err := req.Validate(); err != nil {
+			return err
+		}
+
+		err := a.users.Create(ctx, req.Name, req.Email, req.Password, role)
+		if errors.Is(err, users.ErrEmailAlreadyExists) {
+			fmt.Printf("%s already exists\n", req.Email)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", req.Email, err)
+		}
+
+		fmt.Printf("%s created\n", req.Email)
+	}
+
+	return nil
+}
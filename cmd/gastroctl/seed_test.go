@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/categories"
+	"github.com/EduardoMark/gastro-api/internal/dishes"
+)
+
+func TestDemoMenu(t *testing.T) {
+	var menu Menu
+	if err := json.Unmarshal(demoMenu, &menu); err != nil {
+		t.Fatalf("expected valid demo menu, got %v", err)
+	}
+
+	slugs := map[string]bool{}
+	for _, c := range menu.Categories {
+		if c.Parent != "" && !slugs[categories.Slugify(c.Parent)] {
+			t.Errorf("category %q is listed before its parent %q", c.Name, c.Parent)
+		}
+		slugs[categories.Slugify(c.Name)] = true
+	}
+
+	for _, d := range menu.Dishes {
+		if !slugs[categories.Slugify(d.Category)] {
+			t.Errorf("dish %q has unknown category %q", d.Name, d.Category)
+		}
+
+		req := dishes.CreateRequest{
+			Name:        d.Name,
+			Description: d.Description,
+			Price:       d.Price.InexactFloat64(),
+			CategoryID:  "00000000-0000-0000-0000-000000000000",
+		}
+		if err := req.Validate(); err != nil {
+			t.Errorf("dish %q: %v", d.Name, err)
+		}
+	}
+}
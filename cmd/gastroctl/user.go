@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/EduardoMark/gastro-api/internal/users"
+)
+
+// createAdmin creates an admin account. Unlike the bootstrap admin it works
+// when users already exist, and the account still has to verify its email.
+func (a *app) createAdmin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user create-admin", flag.ContinueOnError)
+	name := fs.String("name", "", "admin name")
+	email := fs.String("email", "", "admin email")
+	password := fs.String("password", "", "admin password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	req := users.SignupRequest{Name: *name, Email: *email, Password: pass}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.users.Create(ctx, req.Name, req.Email, req.Password, users.RoleAdmin); err != nil {
+		return fmt.Errorf("failed to create admin: %v", err)
+	}
+
+	fmt.Printf("admin %s created\n", req.Email)
+	return nil
+}
+
+// resetPassword sets a new password and ends every session of the account,
+// for when its owner is locked out or the account may be compromised.
+func (a *app) resetPassword(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	email := fs.String("email", "", "account email")
+	password := fs.String("password", "", "new password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return fmt.Errorf("field email is required")
+	}
+
+	user, err := a.users.GetUserByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	req := users.ChangePasswordRequest{NewPassword: pass}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.users.ChangePassword(ctx, user.ID, req.NewPassword); err != nil {
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+
+	if err := a.users.EndAllSessions(ctx, user.ID); err != nil {
+		return fmt.Errorf("password changed but failed to end sessions: %v", err)
+	}
+
+	fmt.Printf("password of %s reset, all sessions ended\n", user.Email)
+	return nil
+}
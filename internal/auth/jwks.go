@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+
+	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
+)
+
+// JWK is the public part of a key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verification key, including keys that no longer sign
+// but still have valid tokens in circulation.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range s.Keys() {
+		jwk := JWK{
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// JWKSHandler serves the public keys at /.well-known/jwks.json so other
+// services can verify access tokens.
+func (a *AuthJWTService) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	jsonutils.EncodeJson(w, http.StatusOK, a.KeySet().JWKS())
+}
@@ -2,46 +2,146 @@ package auth
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/EduardoMark/gastro-api/internal/config"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
 type AuthJWTService struct {
-	secret []byte
+	mu       sync.RWMutex
+	keys     *KeySet
+	keysDir  string
+	signKID  string
+	issuer   string
+	audience []string
 }
 
-func NewAuthJWTService(env *config.Env) *AuthJWTService {
-	return &AuthJWTService{
-		secret: []byte(env.JWTSecret),
+// NewAuthJWTService loads the signing keys from cfg.JWTKeysDir. Without a key
+// directory an ephemeral key is generated, which is only suitable for
+// development since tokens stop verifying on restart.
+func NewAuthJWTService(cfg config.Auth) (*AuthJWTService, error) {
+	a := &AuthJWTService{
+		keysDir:  cfg.JWTKeysDir,
+		signKID:  cfg.JWTSigningKeyID,
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
 	}
+
+	if a.keysDir == "" {
+		logrus.Warn("JWT_KEYS_DIR is not set, signing tokens with an ephemeral key")
+
+		keys, err := NewEphemeralKeySet()
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+		return a, nil
+	}
+
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Reload reads the key directory again, so keys can be rotated without a
+// restart: publish the new key first, switch signing to it once every
+// verifier has fetched it, and remove the old key after AccessTokenTTL.
+// The current keys are kept when the directory cannot be loaded.
+func (a *AuthJWTService) Reload() error {
+	if a.keysDir == "" {
+		return nil
+	}
+
+	keys, err := LoadKeySet(a.keysDir, a.signKID)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+
+	logrus.Infof("loaded %d JWT keys, signing with %q", len(keys.Keys()), keys.Signing().ID)
+
+	return nil
 }
 
+// KeySet returns the keys currently in use.
+func (a *AuthJWTService) KeySet() *KeySet {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.keys
+}
+
+// AccessTokenTTL is kept short since refresh tokens are used to renew
+// access tokens.
+const AccessTokenTTL = 15 * time.Minute
+
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// MFA is set when the session was opened with a second factor.
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (a *AuthJWTService) New(userID, role string) (string, error) {
+func (a *AuthJWTService) New(userID, role, sessionID string, mfa bool) (string, error) {
+	key := a.KeySet().Signing()
+
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			ID:        uuid.NewString(),
+			Issuer:    a.issuer,
+			Subject:   userID,
+			Audience:  a.audience,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(a.secret)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
 }
 
+// VerifyToken checks the signature against the key named by the token's kid
+// and rejects tokens using another algorithm than that key's, or issued for
+// another issuer or audience.
 func (a *AuthJWTService) VerifyToken(tokenString string) (*Claims, error) {
+	keys := a.KeySet()
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.Methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience...),
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return a.secret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Get(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+
+		return key.Public, nil
+	}, options...)
 	if err != nil {
 		return nil, err
 	}
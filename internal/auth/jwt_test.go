@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePublicKey(t *testing.T, dir, kid string, key crypto.PublicKey) {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pub.pem"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestConfig(dir string) config.Auth {
+	return config.Auth{
+		JWTKeysDir:  dir,
+		JWTIssuer:   "gastro-api",
+		JWTAudience: []string{"gastro-api"},
+	}
+}
+
+// TESTS
+
+func TestVerifyToken(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should verify tokens signed with the newest key", func(t *testing.T) {
+		dir := t.TempDir()
+		writePrivateKey(t, dir, "2026-01", rsaKey)
+		writePrivateKey(t, dir, "2026-02", edKey)
+
+		a, err := NewAuthJWTService(newTestConfig(dir))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if a.KeySet().Signing().ID != "2026-02" {
+			t.Fatalf("expected signing key 2026-02, got %s", a.KeySet().Signing().ID)
+		}
+
+		token, err := a.New("user-1", "client", "session-1", false)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		claims, err := a.VerifyToken(token)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if claims.UserID != "user-1" || claims.SessionID != "session-1" {
+			t.Errorf("unexpected claims: %+v", claims)
+		}
+	})
+
+	t.Run("should keep verifying tokens of a retired key after rotation", func(t *testing.T) {
+		dir := t.TempDir()
+		writePrivateKey(t, dir, "2026-01", rsaKey)
+
+		a, err := NewAuthJWTService(newTestConfig(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := a.New("user-1", "client", "session-1", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Remove(filepath.Join(dir, "2026-01.pem"))
+		writePublicKey(t, dir, "2026-01", &rsaKey.PublicKey)
+		writePrivateKey(t, dir, "2026-02", edKey)
+
+		if err := a.Reload(); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if _, err := a.VerifyToken(token); err != nil {
+			t.Errorf("expected old token to verify, got: %v", err)
+		}
+
+		if len(a.KeySet().JWKS().Keys) != 2 {
+			t.Errorf("expected 2 keys in JWKS, got %d", len(a.KeySet().JWKS().Keys))
+		}
+	})
+
+	t.Run("should reject tokens signed with another algorithm", func(t *testing.T) {
+		dir := t.TempDir()
+		writePrivateKey(t, dir, "2026-01", rsaKey)
+
+		a, err := NewAuthJWTService(newTestConfig(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		publicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserID: "user-1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "gastro-api",
+				Audience:  jwt.ClaimStrings{"gastro-api"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = "2026-01"
+
+		signed, err := token.SignedString(publicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.VerifyToken(signed); err == nil {
+			t.Error("expected HS256 token to be rejected")
+		}
+	})
+
+	t.Run("should reject tokens for another audience", func(t *testing.T) {
+		dir := t.TempDir()
+		writePrivateKey(t, dir, "2026-01", edKey)
+
+		issuer, err := NewAuthJWTService(config.Auth{
+			JWTKeysDir:  dir,
+			JWTIssuer:   "gastro-api",
+			JWTAudience: []string{"another-service"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := issuer.New("user-1", "client", "session-1", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		verifier, err := NewAuthJWTService(newTestConfig(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := verifier.VerifyToken(token); err == nil {
+			t.Error("expected token for another audience to be rejected")
+		}
+	})
+
+	t.Run("should fail when the signing key does not exist", func(t *testing.T) {
+		dir := t.TempDir()
+		writePrivateKey(t, dir, "2026-01", edKey)
+
+		env := newTestConfig(dir)
+		env.JWTSigningKeyID = "2026-09"
+
+		if _, err := NewAuthJWTService(env); err == nil {
+			t.Error("expected missing signing key to fail")
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys.
+const minRSAKeyBits = 2048
+
+var ErrNoSigningKey = errors.New("no signing key available")
+
+// Key is a signing or verification key identified by its kid. Private is nil
+// for keys that are only kept around to verify tokens issued before a
+// rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds every key accepted for verification and the one used to sign
+// new tokens.
+type KeySet struct {
+	keys    map[string]*Key
+	signing *Key
+}
+
+func (s *KeySet) Signing() *Key {
+	return s.signing
+}
+
+func (s *KeySet) Get(kid string) (*Key, bool) {
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Keys returns the keys of the set ordered by kid.
+func (s *KeySet) Keys() []*Key {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys
+}
+
+// Methods returns the algorithms of the keys in the set, which are the only
+// ones accepted on verification.
+func (s *KeySet) Methods() []string {
+	seen := map[string]bool{}
+	methods := []string{}
+	for _, key := range s.Keys() {
+		alg := key.Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// LoadKeySet reads the keys in dir. Each file is named after its kid:
+// "<kid>.pem" holds a PKCS#8 RSA or Ed25519 private key and "<kid>.pub.pem" a
+// PKIX public key that is only used for verification. The signing key is the
+// private key named signingKID or, when it is empty, the private key with the
+// greatest kid, so naming keys by date rotates them in order.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %v", err)
+	}
+
+	set := &KeySet{keys: map[string]*Key{}}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %v", name, err)
+		}
+
+		var key *Key
+		if kid, ok := strings.CutSuffix(name, ".pub.pem"); ok {
+			key, err = parsePublicKey(kid, data)
+		} else {
+			key, err = parsePrivateKey(strings.TrimSuffix(name, ".pem"), data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %v", name, err)
+		}
+
+		if existing, ok := set.keys[key.ID]; ok && existing.Private != nil {
+			continue
+		}
+		set.keys[key.ID] = key
+	}
+
+	for _, key := range set.Keys() {
+		if key.Private == nil {
+			continue
+		}
+
+		if signingKID == "" || key.ID == signingKID {
+			set.signing = key
+		}
+	}
+
+	if set.signing == nil {
+		if signingKID != "" {
+			return nil, fmt.Errorf("%w: private key %q not found in %s", ErrNoSigningKey, signingKID, dir)
+		}
+		return nil, fmt.Errorf("%w in %s", ErrNoSigningKey, dir)
+	}
+
+	return set, nil
+}
+
+// NewEphemeralKeySet returns a set with a single Ed25519 key generated in
+// memory. Tokens signed with it do not survive a restart, so it is only meant
+// for development.
+func NewEphemeralKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	key := &Key{
+		ID:      "ephemeral",
+		Method:  jwt.SigningMethodEdDSA,
+		Private: private,
+		Public:  public,
+	}
+
+	return &KeySet{
+		keys:    map[string]*Key{key.ID: key},
+		signing: key,
+	}, nil
+}
+
+func parsePrivateKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	key, err := newKey(kid, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	key.Private = signer
+	return key, nil
+}
+
+func parsePublicKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(kid, parsed)
+}
+
+func newKey(kid string, public crypto.PublicKey) (*Key, error) {
+	if kid == "" {
+		return nil, fmt.Errorf("empty key id")
+	}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Public: pub}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Public: pub}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+}
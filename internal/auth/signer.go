@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/EduardoMark/gastro-api/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer signs short payloads, such as the ones embedded in email links, with
+// HMAC-SHA256 so they can be trusted without being stored.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// NewEphemeralSigner returns a signer with a random key. Its signatures do not
+// survive a restart, so it is only meant for development.
+func NewEphemeralSigner() (*Signer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	return NewSigner(key), nil
+}
+
+// NewEmailSigner returns the signer for links sent by email. Without
+// EMAIL_TOKEN_SECRET it falls back to an ephemeral key.
+func NewEmailSigner(cfg config.Auth) (*Signer, error) {
+	if cfg.EmailTokenSecret == "" {
+		logrus.Warn("EMAIL_TOKEN_SECRET is not set, email links will stop working on restart")
+		return NewEphemeralSigner()
+	}
+
+	return NewSigner([]byte(cfg.EmailTokenSecret)), nil
+}
+
+// Sign returns payload and its signature, both base64url encoded and joined
+// by a dot.
+func (s *Signer) Sign(payload []byte) string {
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the payload of a value produced by Sign.
+func (s *Signer) Verify(signed string) ([]byte, error) {
+	rawPayload, rawMAC, ok := strings.Cut(signed, ".")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(rawPayload)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(rawMAC)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	if !hmac.Equal(mac, s.mac(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	return payload, nil
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
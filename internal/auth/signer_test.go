@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	s := NewSigner([]byte("test-key"))
+
+	t.Run("should return the signed payload", func(t *testing.T) {
+		payload, err := s.Verify(s.Sign([]byte("hello")))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if string(payload) != "hello" {
+			t.Errorf("expected hello, got %s", payload)
+		}
+	})
+
+	t.Run("should reject tampered payloads", func(t *testing.T) {
+		signed := s.Sign([]byte("hello"))
+		tampered := NewSigner([]byte("test-key")).Sign([]byte("hellp"))
+
+		_, sig, _ := strings.Cut(signed, ".")
+		payload, _, _ := strings.Cut(tampered, ".")
+
+		if _, err := s.Verify(payload + "." + sig); err == nil {
+			t.Error("expected tampered payload to be rejected")
+		}
+	})
+
+	t.Run("should reject signatures from another key", func(t *testing.T) {
+		other := NewSigner([]byte("other-key"))
+
+		if _, err := s.Verify(other.Sign([]byte("hello"))); err == nil {
+			t.Error("expected signature from another key to be rejected")
+		}
+	})
+}
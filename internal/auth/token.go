@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewOpaqueToken returns a random URL-safe token together with the hash that
+// should be stored in its place.
+func NewOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of an opaque token. Opaque tokens
+// carry enough entropy that a fast hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B test secret "12345678901234567890" in base32.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	t.Run("should match the RFC 6238 test vectors", func(t *testing.T) {
+		tests := []struct {
+			unix int64
+			want string
+		}{
+			{59, "287082"},
+			{1111111109, "081804"},
+			{1234567890, "005924"},
+			{2000000000, "279037"},
+		}
+
+		for _, tt := range tests {
+			got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("should accept codes from the adjacent step", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+
+		step, ok := ValidateTOTP(secret, previous, now)
+		if !ok || step != TOTPStep(now)-1 {
+			t.Errorf("expected previous step to be accepted, got step %d ok %v", step, ok)
+		}
+	})
+
+	t.Run("should reject codes outside the window", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		old, _ := TOTPCode(secret, TOTPStep(now)-3)
+
+		if _, ok := ValidateTOTP(secret, old, now); ok {
+			t.Error("expected old code to be rejected")
+		}
+	})
+}
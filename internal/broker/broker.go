@@ -0,0 +1,162 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event is a single message delivered to subscribers. IDs increase
+// monotonically for the lifetime of the process, which lets a subscriber
+// that reconnects resume from the last ID it saw.
+type Event struct {
+	ID        uint64
+	Type      string
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// Broker is an in-process publish/subscribe hub. It keeps the most recent
+// events in memory so reconnecting subscribers can replay what they missed.
+// Subscribers that fall too far behind are dropped and expected to reconnect.
+type Broker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	historySize int
+	bufferSize  int
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+const (
+	DefaultHistorySize = 256
+	DefaultBufferSize  = 64
+)
+
+func New() *Broker {
+	return &Broker{
+		historySize: DefaultHistorySize,
+		bufferSize:  DefaultBufferSize,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish encodes data as JSON and delivers it to every subscriber.
+func (b *Broker) Publish(eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.nextID++
+	event := Event{
+		ID:        b.nextID,
+		Type:      eventType,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return nil
+}
+
+// Replay holds the events a reconnecting subscriber missed.
+type Replay struct {
+	Events []Event
+	// Gap reports that some of the missed events are no longer held, or that
+	// the last event id comes from before a restart, so Events is incomplete
+	// and the subscriber has to resynchronize. LastID is the id of the latest
+	// event published so far, to resume from once it has.
+	Gap    bool
+	LastID uint64
+}
+
+// Subscribe registers a new subscriber. Events newer than lastEventID that are
+// still held in memory are returned for replay; pass 0 to skip the replay.
+// The returned channel is closed when the subscriber is dropped or the broker
+// is closed, and unsubscribe must be called once the caller is done.
+func (b *Broker) Subscribe(lastEventID uint64) (events <-chan Event, replay Replay, unsubscribe func()) {
+	ch := make(chan Event, b.bufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	replay.LastID = b.nextID
+	if lastEventID > 0 {
+		// IDs are contiguous, so the history starts right after the events
+		// it no longer holds.
+		oldest := b.nextID - uint64(len(b.history)) + 1
+		replay.Gap = lastEventID > b.nextID || lastEventID+1 < oldest
+
+		for _, event := range b.history {
+			if event.ID > lastEventID {
+				replay.Events = append(replay.Events, event)
+			}
+		}
+	}
+
+	if b.closed {
+		close(ch)
+		return ch, replay, func() {}
+	}
+
+	b.subscribers[ch] = struct{}{}
+
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, replay, unsubscribe
+}
+
+// Closed reports whether Close was called.
+func (b *Broker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+// Close disconnects every subscriber and ignores further publishes.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	t.Run("should deliver published events to subscribers", func(t *testing.T) {
+		b := New()
+		events, _, unsubscribe := b.Subscribe(0)
+		defer unsubscribe()
+
+		if err := b.Publish("order.created", map[string]string{"id": "1"}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		event := <-events
+		if event.ID != 1 || event.Type != "order.created" || string(event.Data) != `{"id":"1"}` {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	})
+
+	t.Run("should replay events after the last event id", func(t *testing.T) {
+		b := New()
+		for i := 0; i < 3; i++ {
+			b.Publish("order.created", i)
+		}
+
+		_, replay, unsubscribe := b.Subscribe(1)
+		defer unsubscribe()
+
+		if len(replay.Events) != 2 || replay.Events[0].ID != 2 || replay.Events[1].ID != 3 || replay.Gap {
+			t.Errorf("expected events 2 and 3 to be replayed, got: %+v", replay)
+		}
+	})
+
+	t.Run("should report a gap once missed events left the history", func(t *testing.T) {
+		b := New()
+		for i := 0; i < DefaultHistorySize+2; i++ {
+			b.Publish("order.created", i)
+		}
+
+		_, replay, unsubscribe := b.Subscribe(1)
+		defer unsubscribe()
+
+		if !replay.Gap || replay.LastID != DefaultHistorySize+2 {
+			t.Errorf("expected a gap up to event %d, got gap %v and last id %d", DefaultHistorySize+2, replay.Gap, replay.LastID)
+		}
+
+		_, replay, unsubscribe = b.Subscribe(2)
+		defer unsubscribe()
+
+		if replay.Gap || len(replay.Events) != DefaultHistorySize {
+			t.Errorf("expected the whole history without a gap, got gap %v and %d events", replay.Gap, len(replay.Events))
+		}
+	})
+
+	t.Run("should report a gap for ids from before a restart", func(t *testing.T) {
+		b := New()
+		b.Publish("order.created", 1)
+
+		_, replay, unsubscribe := b.Subscribe(50)
+		defer unsubscribe()
+
+		if !replay.Gap {
+			t.Error("expected a gap for an id the broker never issued")
+		}
+	})
+
+	t.Run("should drop subscribers that fall behind", func(t *testing.T) {
+		b := New()
+		events, _, unsubscribe := b.Subscribe(0)
+		defer unsubscribe()
+
+		for i := 0; i <= DefaultBufferSize; i++ {
+			b.Publish("order.created", i)
+		}
+
+		received := 0
+		for range events {
+			received++
+		}
+
+		if received != DefaultBufferSize {
+			t.Errorf("expected %d buffered events before drop, got: %d", DefaultBufferSize, received)
+		}
+	})
+
+	t.Run("should close subscribers on close", func(t *testing.T) {
+		b := New()
+		events, _, unsubscribe := b.Subscribe(0)
+		defer unsubscribe()
+
+		b.Close()
+
+		if _, ok := <-events; ok {
+			t.Error("expected subscriber channel to be closed")
+		}
+	})
+}
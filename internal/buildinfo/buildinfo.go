@@ -0,0 +1,60 @@
+// Package buildinfo describes the running binary. Version, Commit and
+// BuildTime are injected at build time, for example:
+//
+//	go build -ldflags "-X github.com/EduardoMark/gastro-api/internal/buildinfo.Version=v1.2.0 \
+//	  -X github.com/EduardoMark/gastro-api/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/EduardoMark/gastro-api/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/api
+//
+// Without them, the commit and time recorded by the Go toolchain are used
+// when the binary was built from a git checkout.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
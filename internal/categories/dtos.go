@@ -0,0 +1,81 @@
+package categories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/validation"
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateRequest struct {
+	Name     string  `json:"name" validate:"required,min=2,max=100"`
+	Position int     `json:"position" validate:"min=0"`
+	ParentID *string `json:"parent_id" validate:"omitempty,uuid"`
+}
+
+func (r *CreateRequest) Validate() error {
+	return validateRequest(r)
+}
+
+type UpdateRequest struct {
+	Name     string  `json:"name" validate:"required,min=2,max=100"`
+	Position int     `json:"position" validate:"min=0"`
+	ParentID *string `json:"parent_id" validate:"omitempty,uuid"`
+}
+
+func (r *UpdateRequest) Validate() error {
+	return validateRequest(r)
+}
+
+func validateRequest(r any) error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+			if err.Tag() == "min" && err.Field() == "position" {
+				return fmt.Errorf("field %s must be at least %s", err.Field(), err.Param())
+			}
+			if err.Tag() == "min" {
+				return fmt.Errorf("field %s must be at least %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "uuid" {
+				return fmt.Errorf("field %s must be a valid uuid", err.Field())
+			}
+		}
+	}
+
+	return nil
+}
+
+type CategoryResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Position  int       `json:"position"`
+	ParentID  *string   `json:"parent_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewCategoryResponse(category *Category) CategoryResponse {
+	response := CategoryResponse{
+		ID:        category.ID.String(),
+		Name:      category.Name,
+		Slug:      category.Slug,
+		Position:  category.Position,
+		CreatedAt: category.CreatedAt,
+		UpdatedAt: category.UpdatedAt,
+	}
+
+	if category.ParentID != nil {
+		parentID := category.ParentID.String()
+		response.ParentID = &parentID
+	}
+
+	return response
+}
@@ -0,0 +1,185 @@
+package categories
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type CategoryHandler struct {
+	s   Service
+	jwt *middleware.JWTMiddleware
+}
+
+func NewCategoryHandler(s Service, jwt *middleware.JWTMiddleware) CategoryHandler {
+	return CategoryHandler{
+		s:   s,
+		jwt: jwt,
+	}
+}
+
+func (h *CategoryHandler) CategoryRoutes(r chi.Router) {
+	r.Route("/categories", func(r chi.Router) {
+		// publics
+		r.Get("/", h.Query)
+		r.Get("/{id}", h.GetOne)
+
+		// privates
+		r.Group(func(r chi.Router) {
+			r.Use(h.jwt.JWTAuth)
+			r.Use(middleware.RequirePermission(rbac.PermCategoryWrite))
+
+			r.Post("/", h.Create)
+			r.Put("/{id}", h.Update)
+			r.Delete("/{id}", h.Delete)
+		})
+	})
+}
+
+func (h *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := jsonutils.DecodeJson[CreateRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	record, err := h.s.Create(ctx, body)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusCreated, map[string]CategoryResponse{
+		"category": NewCategoryResponse(record),
+	})
+}
+
+func (h *CategoryHandler) GetOne(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	record, err := h.s.GetOneByID(ctx, id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]CategoryResponse{
+		"category": NewCategoryResponse(record),
+	})
+}
+
+func (h *CategoryHandler) Query(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	records, err := h.s.Query(ctx)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	response := make([]CategoryResponse, len(records))
+	for i, record := range records {
+		response[i] = NewCategoryResponse(record)
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string][]CategoryResponse{
+		"categories": response,
+	})
+}
+
+func (h *CategoryHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[UpdateRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.Update(ctx, id, body); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "category updated with success",
+	})
+}
+
+func (h *CategoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	if err := h.s.Delete(ctx, id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CategoryHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+			"error": "category not found",
+		})
+	case errors.Is(err, ErrCategoryAlreadyExists), errors.Is(err, ErrCategoryInUse):
+		jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrInvalidParent):
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+	default:
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+	}
+}
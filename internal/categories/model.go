@@ -0,0 +1,56 @@
+package categories
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Category groups dishes on the menu. Slugs are unique among the children of
+// the same parent, so sub-categories under different parents may share a name.
+type Category struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	Name      string     `json:"name" gorm:"type:varchar(100);not null"`
+	Slug      string     `json:"slug" gorm:"type:varchar(120);not null;uniqueIndex:idx_categories_parent_slug,priority:2"`
+	Position  int        `json:"position" gorm:"not null;default:0"`
+	ParentID  *uuid.UUID `json:"parent_id" gorm:"type:uuid;index;uniqueIndex:idx_categories_parent_slug,priority:1"`
+	Parent    *Category  `json:"-" gorm:"foreignKey:ParentID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Slugify builds the identifier used to tell sibling categories apart
+// regardless of case and accents, so "Bebidas", "bebidas" and "Bébidas" share
+// the slug "bebidas". The 0003_backfill_categories migration mirrors this in
+// SQL.
+func Slugify(name string) string {
+	folded, _, err := transform.String(
+		transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC),
+		strings.ToLower(strings.TrimSpace(name)),
+	)
+	if err != nil {
+		folded = strings.ToLower(strings.TrimSpace(name))
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range folded {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
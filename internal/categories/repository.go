@@ -0,0 +1,131 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(ctx context.Context, category *Category) error
+	GetOneByID(ctx context.Context, id uuid.UUID) (*Category, error)
+	Query(ctx context.Context) ([]*Category, error)
+	Update(ctx context.Context, category *Category) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type categoryRepository struct {
+	db *gorm.DB
+}
+
+func NewCategoryRepository(db *gorm.DB) Repository {
+	return &categoryRepository{
+		db: db,
+	}
+}
+
+var (
+	ErrCategoryAlreadyExists = errors.New("a category with this name already exists under the same parent")
+	ErrCategoryNotFound      = errors.New("category not found")
+	ErrCategoryInUse         = errors.New("category still has dishes or sub-categories")
+)
+
+func (r *categoryRepository) Create(ctx context.Context, category *Category) error {
+	err := r.db.WithContext(ctx).Create(category).Error
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrCategoryAlreadyExists
+		}
+		return fmt.Errorf("Create - failed to create category: %v", err)
+	}
+
+	return nil
+}
+
+func (r *categoryRepository) GetOneByID(ctx context.Context, id uuid.UUID) (*Category, error) {
+	var category Category
+
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&category).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, fmt.Errorf("GetOneByID - failed to get category: %v", err)
+	}
+
+	return &category, nil
+}
+
+func (r *categoryRepository) Query(ctx context.Context) ([]*Category, error) {
+	var categories []*Category
+
+	err := r.db.WithContext(ctx).
+		Order("position ASC").
+		Order("name ASC").
+		Find(&categories).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("Query - failed to find categories: %v", err)
+	}
+
+	return categories, nil
+}
+
+// Update saves the category and copies its name onto the dishes that belong
+// to it, since dishes keep the name for search and display.
+func (r *categoryRepository) Update(ctx context.Context, category *Category) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Category{}).
+			Where("id = ?", category.ID).
+			Updates(map[string]any{
+				"name":      category.Name,
+				"slug":      category.Slug,
+				"position":  category.Position,
+				"parent_id": category.ParentID,
+			})
+
+		if result.Error != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(result.Error, &pgErr) && pgErr.Code == "23505" {
+				return ErrCategoryAlreadyExists
+			}
+			return fmt.Errorf("Update - failed to update category: %v", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrCategoryNotFound
+		}
+
+		err := tx.Table("dishes").
+			Where("category_id = ?", category.ID).
+			Update("category", category.Name).Error
+		if err != nil {
+			return fmt.Errorf("Update - failed to rename category on dishes: %v", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *categoryRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&Category{})
+
+	if result.Error != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(result.Error, &pgErr) && pgErr.Code == "23503" {
+			return ErrCategoryInUse
+		}
+		return fmt.Errorf("Delete - failed to delete category: %v", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
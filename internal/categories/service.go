@@ -0,0 +1,142 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	Create(ctx context.Context, req CreateRequest) (*Category, error)
+	GetOneByID(ctx context.Context, id uuid.UUID) (*Category, error)
+	Query(ctx context.Context) ([]*Category, error)
+	Update(ctx context.Context, id uuid.UUID, req UpdateRequest) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type categoryService struct {
+	r Repository
+}
+
+func NewCategoryService(r Repository) Service {
+	return &categoryService{
+		r: r,
+	}
+}
+
+// maxDepth bounds the walk up the parent chain when looking for cycles.
+const maxDepth = 32
+
+var (
+	ErrInvalidName   = errors.New("category name must contain letters or digits")
+	ErrInvalidParent = errors.New("invalid parent category")
+)
+
+func (s *categoryService) Create(ctx context.Context, req CreateRequest) (*Category, error) {
+	category := Category{
+		Name:     strings.TrimSpace(req.Name),
+		Slug:     Slugify(req.Name),
+		Position: req.Position,
+	}
+
+	if category.Slug == "" {
+		return nil, ErrInvalidName
+	}
+
+	parentID, err := s.parseParent(ctx, uuid.Nil, req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	category.ParentID = parentID
+
+	if err := s.r.Create(ctx, &category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (s *categoryService) GetOneByID(ctx context.Context, id uuid.UUID) (*Category, error) {
+	record, err := s.r.GetOneByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (s *categoryService) Query(ctx context.Context) ([]*Category, error) {
+	records, err := s.r.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (s *categoryService) Update(ctx context.Context, id uuid.UUID, req UpdateRequest) error {
+	category := Category{
+		ID:       id,
+		Name:     strings.TrimSpace(req.Name),
+		Slug:     Slugify(req.Name),
+		Position: req.Position,
+	}
+
+	if category.Slug == "" {
+		return ErrInvalidName
+	}
+
+	parentID, err := s.parseParent(ctx, id, req.ParentID)
+	if err != nil {
+		return err
+	}
+	category.ParentID = parentID
+
+	if err := s.r.Update(ctx, &category); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *categoryService) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := s.r.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseParent checks that the requested parent exists and that making it the
+// parent of id would not create a cycle. id is uuid.Nil for new categories.
+func (s *categoryService) parseParent(ctx context.Context, id uuid.UUID, raw *string) (*uuid.UUID, error) {
+	if raw == nil || *raw == "" {
+		return nil, nil
+	}
+
+	parentID, err := uuid.Parse(*raw)
+	if err != nil {
+		return nil, ErrInvalidParent
+	}
+
+	current := &parentID
+	for depth := 0; current != nil; depth++ {
+		if *current == id || depth == maxDepth {
+			return nil, ErrInvalidParent
+		}
+
+		ancestor, err := s.r.GetOneByID(ctx, *current)
+		if err != nil {
+			if errors.Is(err, ErrCategoryNotFound) {
+				return nil, ErrInvalidParent
+			}
+			return nil, err
+		}
+
+		current = ancestor.ParentID
+	}
+
+	return &parentID, nil
+}
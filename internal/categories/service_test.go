@@ -0,0 +1,112 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type MockRepository struct {
+	createFunc     func(ctx context.Context, category *Category) error
+	getOneByIDFunc func(ctx context.Context, id uuid.UUID) (*Category, error)
+	queryFunc      func(ctx context.Context) ([]*Category, error)
+	updateFunc     func(ctx context.Context, category *Category) error
+	deleteFunc     func(ctx context.Context, id uuid.UUID) error
+}
+
+func (m *MockRepository) Create(ctx context.Context, category *Category) error {
+	if m.createFunc != nil {
+		return m.createFunc(ctx, category)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetOneByID(ctx context.Context, id uuid.UUID) (*Category, error) {
+	if m.getOneByIDFunc != nil {
+		return m.getOneByIDFunc(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) Query(ctx context.Context) ([]*Category, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) Update(ctx context.Context, category *Category) error {
+	if m.updateFunc != nil {
+		return m.updateFunc(ctx, category)
+	}
+	return nil
+}
+
+func (m *MockRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if m.deleteFunc != nil {
+		return m.deleteFunc(ctx, id)
+	}
+	return nil
+}
+
+// TESTS
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Drinks":           "drinks",
+		"  drinks ":        "drinks",
+		"Pão de Queijo":    "pao-de-queijo",
+		"Pratos & Porções": "pratos-porcoes",
+		"!!!":              "",
+	}
+
+	for name, expected := range cases {
+		if got := Slugify(name); got != expected {
+			t.Errorf("Slugify(%q): expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	root := &Category{ID: uuid.New(), Name: "Bebidas"}
+	child := &Category{ID: uuid.New(), Name: "Sucos", ParentID: &root.ID}
+
+	mockRepo := &MockRepository{
+		getOneByIDFunc: func(ctx context.Context, id uuid.UUID) (*Category, error) {
+			for _, category := range []*Category{root, child} {
+				if category.ID == id {
+					return category, nil
+				}
+			}
+			return nil, ErrCategoryNotFound
+		},
+	}
+
+	s := NewCategoryService(mockRepo)
+
+	t.Run("should reject a descendant as parent", func(t *testing.T) {
+		parentID := child.ID.String()
+		err := s.Update(ctx, root.ID, UpdateRequest{Name: "Bebidas", ParentID: &parentID})
+		if !errors.Is(err, ErrInvalidParent) {
+			t.Errorf("expected ErrInvalidParent, got: %v", err)
+		}
+	})
+
+	t.Run("should reject an unknown parent", func(t *testing.T) {
+		parentID := uuid.NewString()
+		err := s.Update(ctx, child.ID, UpdateRequest{Name: "Sucos", ParentID: &parentID})
+		if !errors.Is(err, ErrInvalidParent) {
+			t.Errorf("expected ErrInvalidParent, got: %v", err)
+		}
+	})
+
+	t.Run("should accept a valid parent", func(t *testing.T) {
+		parentID := root.ID.String()
+		if err := s.Update(ctx, child.ID, UpdateRequest{Name: "Sucos", ParentID: &parentID}); err != nil {
+			t.Errorf("expected no error, but got: %v", err)
+		}
+	})
+}
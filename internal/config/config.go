@@ -0,0 +1,277 @@
+// Package config holds the application settings. They are read from a YAML
+// file, environment variables and command line flags, in increasing order of
+// precedence, on top of the defaults from Default.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ModeDev        = "dev"
+	ModeProduction = "production"
+)
+
+// Config is the whole configuration. Fields are tagged with their YAML key,
+// their environment variable and, for passwords and keys, secret:"true" so
+// Redacted hides them.
+type Config struct {
+	// Mode is "dev" or "production". Outside dev mode the configuration is
+	// refused while it still uses development defaults, such as the database
+	// password or ephemeral signing keys.
+	Mode string `yaml:"mode" env:"APP_MODE"`
+
+	// AppURL is the frontend base URL used in links sent by email.
+	AppURL string `yaml:"app_url" env:"APP_URL"`
+
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Auth      Auth      `yaml:"auth"`
+	Mail      Mail      `yaml:"mail"`
+	Log       Log       `yaml:"log"`
+	Features  Features  `yaml:"features"`
+	Bootstrap Bootstrap `yaml:"bootstrap"`
+}
+
+// Server configures the HTTP server. Requests must send their headers within
+// ReadHeaderTimeout and their body within ReadTimeout. After a SIGTERM the
+// readiness probe fails for ShutdownDelay while requests are still served, so
+// load balancers stop routing to the instance, then in-flight requests get up
+// to ShutdownTimeout to finish before they are closed.
+type Server struct {
+	Addr              string        `yaml:"addr" env:"HTTP_ADDR"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES"`
+}
+
+// Database configures the PostgreSQL connection and its pool. Zero pool
+// limits mean no limit.
+type Database struct {
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            string        `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"ssl_mode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+}
+
+type Auth struct {
+	// JWTKeysDir holds the PEM keys used to sign and verify access tokens.
+	// JWTSigningKeyID picks the signing key, defaulting to the newest one.
+	JWTKeysDir      string   `yaml:"jwt_keys_dir" env:"JWT_KEYS_DIR"`
+	JWTSigningKeyID string   `yaml:"jwt_signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+	JWTIssuer       string   `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	JWTAudience     []string `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+
+	// EmailTokenSecret signs the links sent by email, such as email
+	// verification links.
+	EmailTokenSecret string `yaml:"email_token_secret" env:"EMAIL_TOKEN_SECRET" secret:"true"`
+
+	// TwoFactorRoles lists the roles that must log in with a second factor
+	// before using permission-protected routes.
+	TwoFactorRoles []string `yaml:"two_factor_roles" env:"TWO_FACTOR_REQUIRED_ROLES"`
+}
+
+// Mail configures outgoing email. Driver is either "smtp" or "log"; the log
+// driver writes messages to Dir when it is set and is only allowed in dev mode.
+type Mail struct {
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	Dir          string `yaml:"dir" env:"MAIL_DIR"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// Log configures logrus. Format is either "text" or "json".
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+type Features struct {
+	// MigrateOnStart applies pending migrations when the server starts.
+	// Otherwise the server refuses to start until "migrate up" is run.
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+}
+
+// Bootstrap creates the first admin from these when the users table is empty.
+type Bootstrap struct {
+	AdminName     string `yaml:"admin_name" env:"BOOTSTRAP_ADMIN_NAME"`
+	AdminEmail    string `yaml:"admin_email" env:"BOOTSTRAP_ADMIN_EMAIL"`
+	AdminPassword string `yaml:"admin_password" env:"BOOTSTRAP_ADMIN_PASSWORD" secret:"true"`
+}
+
+// devDatabasePassword is the password of the compose database. It is only
+// accepted in dev mode.
+const devDatabasePassword = "root"
+
+// minSecretLength is the shortest email token secret accepted outside dev
+// mode.
+const minSecretLength = 32
+
+// Default returns the configuration used for anything not set elsewhere.
+// The defaults suit the compose setup; production must override the secrets.
+func Default() *Config {
+	return &Config{
+		Mode:   ModeProduction,
+		AppURL: "http://localhost:3000",
+		Server: Server{
+			Addr:              ":3000",
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       time.Minute,
+			ShutdownDelay:     5 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+		},
+		Database: Database{
+			Host:            "db",
+			Port:            "5432",
+			User:            "postgres",
+			Password:        devDatabasePassword,
+			Name:            "gastro_api",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Auth: Auth{
+			JWTIssuer:      "gastro-api",
+			JWTAudience:    []string{"gastro-api"},
+			TwoFactorRoles: []string{},
+		},
+		Mail: Mail{
+			Driver:   "log",
+			From:     "Gastro API <noreply@gastro-api.local>",
+			SMTPHost: "localhost",
+			SMTPPort: "587",
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Bootstrap: Bootstrap{
+			AdminName: "Admin",
+		},
+	}
+}
+
+func (c *Config) Dev() bool {
+	return c.Mode == ModeDev
+}
+
+// Validate reports every invalid setting at once. Outside dev mode it also
+// refuses development defaults that would leave the deployment insecure.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Mode == ModeDev || c.Mode == ModeProduction, "mode must be %q or %q, got %q", ModeDev, ModeProduction, c.Mode)
+	check(c.AppURL != "", "app_url is required")
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes must be positive")
+	check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes must be positive")
+
+	check(c.Database.Host != "", "database.host is required")
+	check(c.Database.Port != "", "database.port is required")
+	check(c.Database.User != "", "database.user is required")
+	check(c.Database.Name != "", "database.name is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+
+	check(c.Auth.JWTIssuer != "", "auth.jwt_issuer is required")
+	check(len(c.Auth.JWTAudience) > 0, "auth.jwt_audience is required")
+	for _, role := range c.Auth.TwoFactorRoles {
+		check(rbac.IsRole(role), "auth.two_factor_roles: unknown role %q", role)
+	}
+
+	check(c.Mail.Driver == "smtp" || c.Mail.Driver == "log", "mail.driver must be \"smtp\" or \"log\", got %q", c.Mail.Driver)
+	check(c.Mail.From != "", "mail.from is required")
+	if c.Mail.Driver == "smtp" {
+		check(c.Mail.SMTPHost != "" && c.Mail.SMTPPort != "", "mail.smtp_host and mail.smtp_port are required by the smtp driver")
+	}
+
+	_, err := logrus.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: unknown level %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be \"text\" or \"json\", got %q", c.Log.Format)
+
+	check((c.Bootstrap.AdminEmail == "") == (c.Bootstrap.AdminPassword == ""),
+		"bootstrap.admin_email and bootstrap.admin_password must be set together")
+
+	if !c.Dev() {
+		check(c.Database.Password != "" && c.Database.Password != devDatabasePassword,
+			"database.password must be changed from the development default outside dev mode")
+		check(c.Auth.JWTKeysDir != "", "auth.jwt_keys_dir is required outside dev mode, tokens would be signed with an ephemeral key")
+		check(len(c.Auth.EmailTokenSecret) >= minSecretLength,
+			"auth.email_token_secret must be at least %d characters outside dev mode", minSecretLength)
+		check(c.Mail.Driver != "log", "mail.driver must be \"smtp\" outside dev mode, the log driver does not deliver email")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Configure applies the log settings to logrus. It expects a validated
+// configuration.
+func (l Log) Configure() {
+	if level, err := logrus.ParseLevel(l.Level); err == nil {
+		logrus.SetLevel(level)
+	}
+
+	if l.Format == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+}
+
+const redacted = "[redacted]"
+
+// Redacted returns a copy of the configuration with the secrets that are set
+// replaced, so it can be printed or logged.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Auth.JWTAudience = append([]string(nil), c.Auth.JWTAudience...)
+	out.Auth.TwoFactorRoles = append([]string(nil), c.Auth.TwoFactorRoles...)
+
+	walk(reflect.ValueOf(&out).Elem(), "", func(_ string, field reflect.StructField, v reflect.Value) {
+		if field.Tag.Get("secret") == "true" && v.String() != "" {
+			v.SetString(redacted)
+		}
+	})
+
+	return &out
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TESTS
+
+func TestLoad(t *testing.T) {
+	t.Run("should apply file, env and flags in increasing precedence", func(t *testing.T) {
+		path := writeConfig(t, `
+mode: dev
+server:
+  addr: ":4000"
+  write_timeout: 20s
+database:
+  name: from_file
+  user: from_file
+`)
+		t.Setenv("DB_NAME", "from_env")
+		t.Setenv("DB_USER", "from_env")
+
+		cfg, args, err := Load("test", []string{"-config", path, "-database.user=from_flag", "migrate", "up"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if cfg.Server.Addr != ":4000" || cfg.Server.WriteTimeout != 20*time.Second {
+			t.Errorf("expected file values, got %+v", cfg.Server)
+		}
+		if cfg.Server.ReadTimeout != Default().Server.ReadTimeout {
+			t.Errorf("expected default read timeout, got %s", cfg.Server.ReadTimeout)
+		}
+		if cfg.Database.Name != "from_env" {
+			t.Errorf("expected env to override file, got %q", cfg.Database.Name)
+		}
+		if cfg.Database.User != "from_flag" {
+			t.Errorf("expected flag to override env, got %q", cfg.Database.User)
+		}
+		if strings.Join(args, " ") != "migrate up" {
+			t.Errorf("expected remaining args, got %v", args)
+		}
+	})
+
+	t.Run("should parse lists, booleans and durations from env", func(t *testing.T) {
+		t.Setenv("APP_MODE", "dev")
+		t.Setenv("TWO_FACTOR_REQUIRED_ROLES", "admin, manager")
+		t.Setenv("MIGRATE_ON_START", "true")
+		t.Setenv("SHUTDOWN_TIMEOUT", "45s")
+
+		cfg, _, err := Load("test", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if strings.Join(cfg.Auth.TwoFactorRoles, ",") != "admin,manager" {
+			t.Errorf("unexpected roles %v", cfg.Auth.TwoFactorRoles)
+		}
+		if !cfg.Features.MigrateOnStart {
+			t.Error("expected migrate on start")
+		}
+		if cfg.Server.ShutdownTimeout != 45*time.Second {
+			t.Errorf("unexpected shutdown timeout %s", cfg.Server.ShutdownTimeout)
+		}
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		t.Setenv("APP_MODE", "dev")
+		t.Setenv("HTTP_READ_TIMEOUT", "ten seconds")
+
+		if _, _, err := Load("test", nil); err == nil {
+			t.Fatal("expected error for invalid duration")
+		}
+	})
+
+	t.Run("should reject unknown keys in the file", func(t *testing.T) {
+		path := writeConfig(t, "mode: dev\nserver:\n  adress: \":4000\"\n")
+
+		if _, _, err := Load("test", []string{"-config", path}); err == nil {
+			t.Fatal("expected error for unknown key")
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("should refuse development defaults outside dev mode", func(t *testing.T) {
+		err := Default().Validate()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		for _, field := range []string{"database.password", "auth.jwt_keys_dir", "auth.email_token_secret", "mail.driver"} {
+			if !strings.Contains(err.Error(), field) {
+				t.Errorf("expected error about %s, got %v", field, err)
+			}
+		}
+	})
+
+	t.Run("should accept development defaults in dev mode", func(t *testing.T) {
+		cfg := Default()
+		cfg.Mode = ModeDev
+
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("should accept a production configuration", func(t *testing.T) {
+		cfg := Default()
+		cfg.Database.Password = "a-real-password"
+		cfg.Auth.JWTKeysDir = "/etc/gastro-api/jwt"
+		cfg.Auth.EmailTokenSecret = strings.Repeat("s", minSecretLength)
+		cfg.Mail.Driver = "smtp"
+
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("should reject the log mail driver outside dev mode", func(t *testing.T) {
+		cfg := Default()
+		cfg.Database.Password = "a-real-password"
+		cfg.Auth.JWTKeysDir = "/etc/gastro-api/jwt"
+		cfg.Auth.EmailTokenSecret = strings.Repeat("s", minSecretLength)
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "mail.driver") {
+			t.Fatalf("expected error about mail.driver, got %v", err)
+		}
+	})
+
+	t.Run("should reject unknown two-factor roles", func(t *testing.T) {
+		cfg := Default()
+		cfg.Mode = ModeDev
+		cfg.Auth.TwoFactorRoles = []string{"chef"}
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.EmailTokenSecret = "email-secret"
+
+	out := cfg.Redacted()
+
+	if out.Database.Password != redacted || out.Auth.EmailTokenSecret != redacted {
+		t.Errorf("expected secrets to be redacted, got %+v", out)
+	}
+	if out.Mail.SMTPPassword != "" {
+		t.Errorf("expected empty secrets to stay empty, got %q", out.Mail.SMTPPassword)
+	}
+	if cfg.Database.Password != devDatabasePassword || cfg.Auth.EmailTokenSecret != "email-secret" {
+		t.Error("expected the original configuration to be unchanged")
+	}
+}
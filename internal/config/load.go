@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration for the program called name from args. Each
+// source overrides the previous one:
+//
+//  1. the defaults from Default
+//  2. the YAML file given by -config or CONFIG_FILE
+//  3. environment variables, such as DB_PASSWORD
+//  4. flags named after the YAML keys, such as -database.password
+//
+// Empty environment variables are ignored. The result is validated, and the
+// arguments left after the flags are returned for subcommands.
+func Load(name string, args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration `file`")
+
+	// Flags are recorded while parsing and applied after the file and the
+	// environment, which they override.
+	var overrides []func() error
+	walk(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.StructField, v reflect.Value) {
+		usage := "overrides " + path
+		if env := field.Tag.Get("env"); env != "" {
+			usage += " (env " + env + ")"
+		}
+
+		record := func(raw string) error {
+			overrides = append(overrides, func() error {
+				if err := setValue(v, raw); err != nil {
+					return fmt.Errorf("flag -%s: %v", path, err)
+				}
+				return nil
+			})
+			return nil
+		}
+
+		if v.Kind() == reflect.Bool {
+			fs.BoolFunc(path, usage, record)
+		} else {
+			fs.Func(path, usage, record)
+		}
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		if err := loadFile(cfg, *file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := loadEnv(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	for _, apply := range overrides {
+		if err := apply(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// loadFile reads a YAML file over cfg. Unknown keys are rejected so typos do
+// not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	var errs []error
+
+	walk(reflect.ValueOf(cfg).Elem(), "", func(_ string, field reflect.StructField, v reflect.Value) {
+		key := field.Tag.Get("env")
+		if key == "" {
+			return
+		}
+
+		raw := os.Getenv(key)
+		if raw == "" {
+			return
+		}
+
+		if err := setValue(v, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// WriteYAML writes cfg as YAML, in the format accepted by the -config file.
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// walk calls fn for every setting of the struct v, with its dotted YAML path
+// such as "database.password".
+func walk(v reflect.Value, prefix string, fn func(path string, field reflect.StructField, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), path+".", fn)
+			continue
+		}
+
+		fn(path, field, v.Field(i))
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into v. Durations use time.ParseDuration, such as
+// "10s", and lists are comma separated.
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use a value such as 10s", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
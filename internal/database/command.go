@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// RunMigrateCommand implements the "migrate up", "migrate down [steps]" and
+// "migrate status" subcommands shared by the binaries. down rolls back one
+// migration unless told otherwise.
+func RunMigrateCommand(ctx context.Context, db *gorm.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := MigrateUp(ctx, db)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := MigrateDown(ctx, db, steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "rolled back %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Fprintln(out, "no applied migrations")
+		}
+		return nil
+
+	case "status":
+		status, err := Status(ctx, db)
+		if status == nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+		return err
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -3,29 +3,35 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net"
+	"net/url"
 
 	"github.com/EduardoMark/gastro-api/internal/config"
-	"github.com/EduardoMark/gastro-api/internal/dishes"
-	"github.com/EduardoMark/gastro-api/internal/order"
-	"github.com/EduardoMark/gastro-api/internal/users"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func New(env *config.Env) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		env.DbUser,
-		env.DbPassword,
-		env.DbHost,
-		env.DbPort,
-		env.DbName,
-	)
+// New opens the connection pool described by cfg and checks it can reach the
+// database.
+func New(cfg config.Database) (*gorm.DB, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
 
-	sqlDB, err := sql.Open("pgx", dsn)
+	sqlDB, err := sql.Open("pgx", dsn.String())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open pgx connection: %v", err)
 	}
 
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
 	db, err := gorm.Open(postgres.New(postgres.Config{
 		Conn: sqlDB,
 	}), &gorm.Config{})
@@ -39,12 +45,3 @@ func New(env *config.Env) (*gorm.DB, error) {
 
 	return db, nil
 }
-
-func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		users.User{},
-		dishes.Dish{},
-		order.Order{},
-		order.OrderItem{},
-	)
-}
@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations live in migrations/ as pairs of <version>_<name>.up.sql and
+// <version>_<name>.down.sql files. Each one runs in its own transaction,
+// together with its row in schema_migrations, so a failed migration leaves
+// nothing behind. Statements that cannot run in a transaction, such as
+// CREATE INDEX CONCURRENTLY, are not supported.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the advisory lock held while migrating, so
+// replicas starting at the same time apply each migration once.
+const migrationLockKey = 727002
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a known migration and when it was applied, if it was.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint PRIMARY KEY,
+	name varchar(255) NOT NULL,
+	applied_at timestamptz NOT NULL
+)`
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return loadMigrations(sub)
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected file %s in migrations", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", entry.Name(), err)
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones it
+// applied.
+func MigrateUp(ctx context.Context, db *gorm.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = withMigrationLock(ctx, db, func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execSQL(tx, m.Up); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %v", m.Version, m.Name, err)
+			}
+
+			applied = append(applied, m)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first,
+// and returns the ones it rolled back.
+func MigrateDown(ctx context.Context, db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = withMigrationLock(ctx, db, func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execSQL(tx, m.Down); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to roll back migration %d_%s: %v", m.Version, m.Name, err)
+			}
+
+			reverted = append(reverted, m)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every known migration with when it was applied. It fails when
+// the database has migrations this build does not know, i.e. it was migrated
+// by a newer version.
+func Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := db.WithContext(ctx)
+
+	done := map[int64]time.Time{}
+	if conn.Migrator().HasTable(&schemaMigration{}) {
+		done, err = appliedVersions(conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i].Migration = m
+		if appliedAt, ok := done[m.Version]; ok {
+			status[i].AppliedAt = &appliedAt
+			delete(done, m.Version)
+		}
+	}
+
+	if len(done) > 0 {
+		return status, ErrUnknownMigrations
+	}
+
+	return status, nil
+}
+
+// Pending returns the migrations that were not applied yet.
+func Pending(ctx context.Context, db *gorm.DB) ([]Migration, error) {
+	status, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+var ErrUnknownMigrations = errors.New("database has migrations unknown to this version")
+
+// withMigrationLock runs fn on a single connection holding the migration
+// advisory lock. The lock is session-level, so it is released when fn
+// returns even though each migration commits on its own.
+func withMigrationLock(ctx context.Context, db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+
+		if err := conn.Exec(createSchemaMigrations).Error; err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %v", err)
+		}
+
+		return fn(conn)
+	})
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]time.Time, error) {
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+
+	done := make(map[int64]time.Time, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row.AppliedAt
+	}
+
+	return done, nil
+}
+
+// execSQL runs a migration file. Files may hold several statements, which
+// the simple query protocol used for queries without arguments allows.
+// Files with nothing but comments are skipped.
+func execSQL(tx *gorm.DB, sql string) error {
+	if onlyComments(sql) {
+		return nil
+	}
+
+	return tx.Exec(sql).Error
+}
+
+func onlyComments(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
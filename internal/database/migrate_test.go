@@ -0,0 +1,85 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Run("embedded migrations load in order", func(t *testing.T) {
+		migrations, err := Migrations()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(migrations) == 0 {
+			t.Fatal("expected embedded migrations")
+		}
+
+		for i := 1; i < len(migrations); i++ {
+			if migrations[i].Version <= migrations[i-1].Version {
+				t.Errorf("expected increasing versions, got %d after %d", migrations[i].Version, migrations[i-1].Version)
+			}
+		}
+	})
+
+	t.Run("sorts by version, not by name", func(t *testing.T) {
+		migrations, err := loadMigrations(fstest.MapFS{
+			"10_b.up.sql":   {Data: []byte("SELECT 10;")},
+			"10_b.down.sql": {Data: []byte("SELECT -10;")},
+			"9_a.up.sql":    {Data: []byte("SELECT 9;")},
+			"9_a.down.sql":  {Data: []byte("SELECT -9;")},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(migrations) != 2 || migrations[0].Version != 9 || migrations[1].Version != 10 {
+			t.Fatalf("expected versions 9 and 10, got %+v", migrations)
+		}
+
+		if migrations[0].Up != "SELECT 9;" || migrations[0].Down != "SELECT -9;" {
+			t.Errorf("unexpected migration content %+v", migrations[0])
+		}
+	})
+
+	t.Run("requires a down file", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"1_a.up.sql": {Data: []byte("SELECT 1;")},
+		})
+		if err == nil {
+			t.Fatal("expected error for missing down file")
+		}
+	})
+
+	t.Run("rejects unexpected files", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"1_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"1_a.down.sql": {Data: []byte("SELECT -1;")},
+			"notes.sql":    {Data: []byte("-- notes")},
+		})
+		if err == nil {
+			t.Fatal("expected error for unexpected file")
+		}
+	})
+
+	t.Run("rejects two names for one version", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"1_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"1_b.down.sql": {Data: []byte("SELECT -1;")},
+		})
+		if err == nil {
+			t.Fatal("expected error for mismatched names")
+		}
+	})
+}
+
+func TestOnlyComments(t *testing.T) {
+	if !onlyComments("-- nothing to undo\n\n  -- really\n") {
+		t.Error("expected comment-only file to be detected")
+	}
+
+	if onlyComments("-- drop it\nDROP TABLE x;") {
+		t.Error("expected statement to be detected")
+	}
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS order_status_histories;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS stock_movements;
+DROP TABLE IF EXISTS dishes;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
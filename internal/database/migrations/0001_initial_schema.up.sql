@@ -0,0 +1,192 @@
+-- Schema as previously created by GORM AutoMigrate. Every statement is
+-- guarded so databases created by AutoMigrate are adopted as they are; they
+-- must be on the schema of the last release that still used AutoMigrate.
+
+CREATE TABLE IF NOT EXISTS users (
+    id text DEFAULT gen_random_uuid(),
+    name varchar(100) NOT NULL,
+    email text NOT NULL,
+    password_hash text NOT NULL,
+    role varchar(50) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    phone varchar(20) NOT NULL DEFAULT '',
+    preferences jsonb NOT NULL DEFAULT '{}',
+    deleted_at timestamptz,
+    email_verified_at timestamptz,
+    verification_sent_at timestamptz,
+    totp_secret varchar(64) NOT NULL DEFAULT '',
+    totp_enabled_at timestamptz,
+    totp_last_step bigint,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid DEFAULT gen_random_uuid(),
+    user_id text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    revoked_reason varchar(100),
+    mfa boolean NOT NULL DEFAULT false,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id uuid DEFAULT gen_random_uuid(),
+    session_id uuid NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_refresh_tokens_session FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id uuid DEFAULT gen_random_uuid(),
+    user_id text NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key varchar(320),
+    failures bigint NOT NULL DEFAULT 0,
+    last_failure_at timestamptz NOT NULL,
+    locked_until timestamptz,
+    PRIMARY KEY (key)
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id uuid DEFAULT gen_random_uuid(),
+    user_id text NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id uuid DEFAULT gen_random_uuid(),
+    name varchar(100) NOT NULL,
+    prefix varchar(16) NOT NULL,
+    key_hash varchar(64) NOT NULL,
+    user_id text NOT NULL,
+    scopes jsonb NOT NULL,
+    created_by uuid NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id uuid DEFAULT gen_random_uuid(),
+    name varchar(100) NOT NULL,
+    slug varchar(120) NOT NULL,
+    position bigint NOT NULL DEFAULT 0,
+    parent_id uuid,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_categories_parent FOREIGN KEY (parent_id) REFERENCES categories (id) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
+
+CREATE TABLE IF NOT EXISTS dishes (
+    id text DEFAULT gen_random_uuid(),
+    name varchar(100) NOT NULL,
+    description text NOT NULL,
+    price numeric(10,2) NOT NULL,
+    category varchar(100) NOT NULL,
+    category_id uuid,
+    available boolean NOT NULL DEFAULT true,
+    stock bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_dishes_category_ref FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+    CONSTRAINT chk_dishes_stock_non_negative CHECK (stock >= 0)
+);
+CREATE INDEX IF NOT EXISTS idx_dishes_deleted_at ON dishes (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_dishes_category_id ON dishes (category_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dishes_name_active ON dishes (name) WHERE deleted_at IS NULL;
+
+-- Older schemas made dish names unique across soft deleted dishes too.
+ALTER TABLE dishes DROP CONSTRAINT IF EXISTS uni_dishes_name;
+ALTER TABLE dishes DROP CONSTRAINT IF EXISTS dishes_name_key;
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id uuid DEFAULT gen_random_uuid(),
+    dish_id uuid NOT NULL,
+    delta bigint NOT NULL,
+    stock_after bigint NOT NULL,
+    reason varchar(50) NOT NULL,
+    order_id uuid,
+    user_id uuid,
+    note text,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_order_id ON stock_movements (order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_dish_id ON stock_movements (dish_id);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id uuid DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    status varchar(100) NOT NULL,
+    total_amount numeric,
+    cancelled_by uuid,
+    cancelled_at timestamptz,
+    cancel_reason text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id uuid DEFAULT gen_random_uuid(),
+    order_id uuid NOT NULL,
+    dish_id text NOT NULL,
+    quantity bigint,
+    price numeric,
+    sub_total numeric,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_order_items_dish FOREIGN KEY (dish_id) REFERENCES dishes (id),
+    CONSTRAINT fk_orders_items FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS order_status_histories (
+    id uuid DEFAULT gen_random_uuid(),
+    order_id uuid NOT NULL,
+    from_status varchar(100),
+    to_status varchar(100) NOT NULL,
+    changed_by uuid NOT NULL,
+    reason text,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_orders_history FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_order_status_histories_order_id ON order_status_histories (order_id);
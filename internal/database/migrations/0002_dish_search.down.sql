@@ -0,0 +1,4 @@
+-- The unaccent extension is left installed; other objects may use it.
+DROP INDEX IF EXISTS idx_dishes_search_vector;
+ALTER TABLE dishes DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
@@ -0,0 +1,17 @@
+-- Accent-insensitive full-text search on dishes. unaccent() is only STABLE,
+-- so it is wrapped in an IMMUTABLE function to be usable in a generated
+-- column.
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text
+    AS $$ SELECT public.unaccent('public.unaccent', $1) $$
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+ALTER TABLE dishes ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('portuguese', immutable_unaccent(coalesce(name, ''))), 'A') ||
+        setweight(to_tsvector('portuguese', immutable_unaccent(coalesce(category, ''))), 'B') ||
+        setweight(to_tsvector('portuguese', immutable_unaccent(coalesce(description, ''))), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_dishes_search_vector ON dishes USING GIN (search_vector);
@@ -0,0 +1 @@
+-- Data only; the categories created by the backfill are kept.
@@ -0,0 +1,21 @@
+-- Create a category for every distinct free-text category still found on
+-- dishes and link those dishes to it. The slug expression mirrors
+-- categories.Slugify. Dishes that already have a category_id are left alone.
+INSERT INTO categories (name, slug, position, created_at, updated_at)
+    SELECT DISTINCT ON (slug) name, slug, 0, NOW(), NOW()
+    FROM (
+        SELECT
+            TRIM(category) AS name,
+            TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(immutable_unaccent(TRIM(category))), '[^a-z0-9]+', '-', 'g')) AS slug
+        FROM dishes
+        WHERE category_id IS NULL
+    ) AS legacy
+    WHERE slug <> ''
+    ORDER BY slug, name
+    ON CONFLICT (slug) DO NOTHING;
+
+UPDATE dishes AS d
+    SET category_id = c.id, category = c.name
+    FROM categories AS c
+    WHERE d.category_id IS NULL
+    AND c.slug = TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(immutable_unaccent(TRIM(d.category))), '[^a-z0-9]+', '-', 'g'));
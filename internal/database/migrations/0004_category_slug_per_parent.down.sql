@@ -0,0 +1,4 @@
+-- Fails while sub-categories under different parents share a slug; rename
+-- them first.
+DROP INDEX IF EXISTS idx_categories_parent_slug;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
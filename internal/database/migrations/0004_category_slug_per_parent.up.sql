@@ -0,0 +1,6 @@
+-- Category slugs only have to be unique among siblings, so sub-categories
+-- with the same name can live under different parents, e.g. "Sucos" under
+-- both "Bebidas" and "Sobremesas". NULLS NOT DISTINCT (PostgreSQL 15+) keeps
+-- root categories unique too.
+DROP INDEX IF EXISTS idx_categories_slug;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_parent_slug ON categories (parent_id, slug) NULLS NOT DISTINCT;
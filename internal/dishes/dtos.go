@@ -6,13 +6,15 @@ import (
 
 	"github.com/EduardoMark/gastro-api/internal/validation"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type CreateRequest struct {
 	Name        string  `json:"name" validate:"required,min=3,max=100"`
 	Description string  `json:"description" validate:"required,min=3,max=500"`
 	Price       float64 `json:"price" validate:"gt=0"`
-	Category    string  `json:"category" validate:"required,min=3,max=100"`
+	CategoryID  string  `json:"category_id" validate:"required,uuid"`
 }
 
 func (r *CreateRequest) Validate() error {
@@ -30,6 +32,9 @@ func (r *CreateRequest) Validate() error {
 			if err.Tag() == "gt" {
 				return fmt.Errorf("field %s need a greater than 0 value", err.Field())
 			}
+			if err.Tag() == "uuid" {
+				return fmt.Errorf("field %s must be a valid uuid", err.Field())
+			}
 		}
 	}
 
@@ -42,15 +47,39 @@ type DishResponse struct {
 	Description string    `json:"description"`
 	Price       string    `json:"price"`
 	Category    string    `json:"category"`
+	CategoryID  *string   `json:"category_id"`
+	Available   bool      `json:"available"`
+	Stock       *int      `json:"stock"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+func NewDishResponse(dish *Dish) DishResponse {
+	response := DishResponse{
+		ID:          dish.ID.String(),
+		Name:        dish.Name,
+		Description: dish.Description,
+		Price:       dish.Price.String(),
+		Category:    dish.Category,
+		Available:   dish.Available,
+		Stock:       dish.Stock,
+		CreatedAt:   dish.CreatedAt,
+		UpdatedAt:   dish.UpdatedAt,
+	}
+
+	if dish.CategoryID != nil {
+		categoryID := dish.CategoryID.String()
+		response.CategoryID = &categoryID
+	}
+
+	return response
+}
+
 type UpdateRequest struct {
 	Name        string  `json:"name" validate:"required,min=3,max=100"`
 	Description string  `json:"description" validate:"required,min=3,max=500"`
 	Price       float64 `json:"price" validate:"gt=0"`
-	Category    string  `json:"category" validate:"required,min=3,max=100"`
+	CategoryID  string  `json:"category_id" validate:"required,uuid"`
 }
 
 func (r *UpdateRequest) Validate() error {
@@ -68,8 +97,174 @@ func (r *UpdateRequest) Validate() error {
 			if err.Tag() == "gt" {
 				return fmt.Errorf("field %s need a greater than 0 value", err.Field())
 			}
+			if err.Tag() == "uuid" {
+				return fmt.Errorf("field %s must be a valid uuid", err.Field())
+			}
+		}
+	}
+
+	return nil
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// SortFields maps the values accepted by the sort query parameter to the
+// columns they order by.
+var SortFields = map[string]string{
+	"name":       "name",
+	"price":      "price",
+	"created_at": "created_at",
+}
+
+type QueryFilter struct {
+	Search     string
+	Category   string
+	CategoryID *uuid.UUID
+	Available  *bool
+	MinPrice   *decimal.Decimal
+	MaxPrice   *decimal.Decimal
+	Sort       string
+	Desc       bool
+	Page       int
+	Limit      int
+}
+
+// Normalize fills in the default page, limit and sort order and caps the
+// limit at MaxPageLimit.
+func (f *QueryFilter) Normalize() {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.Limit < 1 {
+		f.Limit = DefaultPageLimit
+	}
+	if f.Limit > MaxPageLimit {
+		f.Limit = MaxPageLimit
+	}
+	if _, ok := SortFields[f.Sort]; !ok {
+		f.Sort = "name"
+	}
+}
+
+type AvailabilityRequest struct {
+	Available *bool `json:"available" validate:"required"`
+}
+
+func (r *AvailabilityRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+
+	return nil
+}
+
+type ListDishesResponse struct {
+	Dishes []DishResponse `json:"dishes"`
+	Page   int            `json:"page"`
+	Limit  int            `json:"limit"`
+	Total  int64          `json:"total"`
+}
+
+// SetStockRequest sets the stock of a dish. Stock is required unless Track is
+// false, which stops tracking the stock of the dish.
+type SetStockRequest struct {
+	Stock *int   `json:"stock" validate:"omitempty,min=0"`
+	Track *bool  `json:"track"`
+	Note  string `json:"note" validate:"max=500"`
+}
+
+func (r *SetStockRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "min" {
+				return fmt.Errorf("field %s must be at least %s", err.Field(), err.Param())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
 		}
 	}
 
+	if r.Track != nil && !*r.Track {
+		if r.Stock != nil {
+			return fmt.Errorf("field Stock must be omitted when Track is false")
+		}
+		return nil
+	}
+
+	if r.Stock == nil {
+		return fmt.Errorf("field Stock is required, send track false to stop tracking the stock")
+	}
+
 	return nil
 }
+
+type AdjustStockRequest struct {
+	Delta int    `json:"delta" validate:"required"`
+	Note  string `json:"note" validate:"max=500"`
+}
+
+func (r *AdjustStockRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required and cannot be 0", err.Field())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+		}
+	}
+
+	return nil
+}
+
+type StockMovementResponse struct {
+	ID         string      `json:"id"`
+	DishID     string      `json:"dish_id"`
+	Delta      int         `json:"delta"`
+	StockAfter int         `json:"stock_after"`
+	Reason     StockReason `json:"reason"`
+	OrderID    *string     `json:"order_id"`
+	UserID     *string     `json:"user_id"`
+	Note       string      `json:"note,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+func NewStockMovementResponse(movement *StockMovement) StockMovementResponse {
+	response := StockMovementResponse{
+		ID:         movement.ID.String(),
+		DishID:     movement.DishID.String(),
+		Delta:      movement.Delta,
+		StockAfter: movement.StockAfter,
+		Reason:     movement.Reason,
+		Note:       movement.Note,
+		CreatedAt:  movement.CreatedAt,
+	}
+
+	if movement.OrderID != nil {
+		orderID := movement.OrderID.String()
+		response.OrderID = &orderID
+	}
+
+	if movement.UserID != nil {
+		userID := movement.UserID.String()
+		response.UserID = &userID
+	}
+
+	return response
+}
+
+type ListMovementsResponse struct {
+	Movements []StockMovementResponse `json:"movements"`
+	Page      int                     `json:"page"`
+	Limit     int                     `json:"limit"`
+	Total     int64                   `json:"total"`
+}
@@ -2,13 +2,18 @@ package dishes
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
 	"github.com/EduardoMark/gastro-api/internal/users"
 	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type DishHandler struct {
@@ -25,38 +30,32 @@ func NewDishHandler(s Service, jwt *middleware.JWTMiddleware) DishHandler {
 
 func (h *DishHandler) DishRoutes(r chi.Router) {
 	r.Route("/dishes", func(r chi.Router) {
-		// publics
-		r.Get("/{id}", h.GetOne)
-		r.Get("/", h.Query)
+		// publics, staff with dish:read:all also see unavailable dishes
+		r.Group(func(r chi.Router) {
+			r.Use(h.jwt.OptionalJWTAuth)
+
+			r.Get("/search", h.Search)
+			r.Get("/{id}", h.GetOne)
+			r.Get("/", h.Query)
+		})
 
 		// privates
 		r.Group(func(r chi.Router) {
 			r.Use(h.jwt.JWTAuth)
 
-			r.Post("/", h.Create)
-			r.Put("/{id}", h.Update)
-			r.Delete("/{id}", h.Delete)
+			r.With(middleware.RequirePermission(rbac.PermDishWrite)).Post("/", h.Create)
+			r.With(middleware.RequirePermission(rbac.PermDishWrite)).Put("/{id}", h.Update)
+			r.With(middleware.RequirePermission(rbac.PermDishAvailability)).Patch("/{id}/availability", h.SetAvailability)
+			r.With(middleware.RequirePermission(rbac.PermStockWrite)).Put("/{id}/stock", h.SetStock)
+			r.With(middleware.RequirePermission(rbac.PermStockWrite)).Post("/{id}/stock/adjustments", h.AdjustStock)
+			r.With(middleware.RequirePermission(rbac.PermStockRead)).Get("/{id}/stock/movements", h.QueryMovements)
+			r.With(middleware.RequirePermission(rbac.PermDishWrite)).Delete("/{id}", h.Delete)
 		})
 	})
 }
 
 func (h *DishHandler) Create(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	role, ok := ctx.Value(middleware.CtxUserRole).(string)
-	if !ok {
-		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
-			"error": "user role not found",
-		})
-		return
-	}
-
-	if role != string(users.RoleAdmin) {
-		jsonutils.EncodeJson(w, http.StatusForbidden, map[string]string{
-			"error": "forbidden: admin only",
-		})
-		return
-	}
-
 	body, err := jsonutils.DecodeJson[CreateRequest](r)
 	if err != nil {
 		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
@@ -72,22 +71,46 @@ func (h *DishHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.s.Create(ctx, body.Name, body.Description, body.Category, body.Price); err != nil {
+	categoryID, err := uuid.Parse(body.CategoryID)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	record, err := h.s.Create(ctx, body.Name, body.Description, categoryID, body.Price)
+	if err != nil {
 		if errors.Is(err, ErrDishAlreadyExists) {
 			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
 				"error": "dish already exists",
 			})
 			return
 		}
+
+		if errors.Is(err, ErrCategoryNotFound) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": "category not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
 	}
 
-	jsonutils.EncodeJson(w, http.StatusCreated, map[string]string{
-		"error": "dish created with success",
+	jsonutils.EncodeJson(w, http.StatusCreated, map[string]DishResponse{
+		"dish": NewDishResponse(record),
 	})
 }
 
+// GetOne returns a dish. Like the listing, it hides unavailable dishes from
+// callers whose role cannot see the whole menu.
 func (h *DishHandler) GetOne(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	role, _ := ctx.Value(middleware.CtxUserRole).(string)
 	idRaw := chi.URLParam(r, "id")
 
 	id, err := uuid.Parse(idRaw)
@@ -99,6 +122,9 @@ func (h *DishHandler) GetOne(w http.ResponseWriter, r *http.Request) {
 	}
 
 	record, err := h.s.GetOneByID(ctx, id)
+	if err == nil && !record.Available && !users.Role(role).Can(rbac.PermDishReadAll) {
+		err = ErrDishNotFound
+	}
 	if err != nil {
 		if errors.Is(err, ErrDishNotFound) {
 			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
@@ -113,26 +139,188 @@ func (h *DishHandler) GetOne(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := DishResponse{
-		ID:          record.ID.String(),
-		Name:        record.Name,
-		Description: record.Description,
-		Price:       record.Price.String(),
-		Category:    record.Category,
-		CreatedAt:   record.CreatedAt,
-		UpdatedAt:   record.UpdatedAt,
-	}
-
 	jsonutils.EncodeJson(w, http.StatusOK, map[string]DishResponse{
-		"dish": response,
+		"dish": NewDishResponse(record),
 	})
 }
 
 func (h *DishHandler) Query(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	records, err := h.s.Query(ctx)
+	role, _ := ctx.Value(middleware.CtxUserRole).(string)
+	filter, err := parseQueryFilter(r, users.Role(role))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	records, total, err := h.s.Query(ctx, filter)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	response := ListDishesResponse{
+		Dishes: make([]DishResponse, len(records)),
+		Page:   filter.Page,
+		Limit:  filter.Limit,
+		Total:  total,
+	}
+	for i, record := range records {
+		response.Dishes[i] = NewDishResponse(record)
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, response)
+}
+
+func (h *DishHandler) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	role, _ := ctx.Value(middleware.CtxUserRole).(string)
+	filter, err := parseQueryFilter(r, users.Role(role))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	records, total, err := h.s.Search(ctx, filter)
+	if err != nil {
+		if errors.Is(err, ErrEmptySearch) {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "query parameter q is required",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	response := ListDishesResponse{
+		Dishes: make([]DishResponse, len(records)),
+		Page:   filter.Page,
+		Limit:  filter.Limit,
+		Total:  total,
+	}
+	for i, record := range records {
+		response.Dishes[i] = NewDishResponse(record)
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, response)
+}
+
+// parseQueryFilter reads the pagination, filter and sort query parameters of
+// GET /dishes. The sort parameter takes a field name, optionally prefixed
+// with "-" for descending order, e.g. sort=-price. Only roles allowed to see
+// the whole menu may filter on availability; everyone else only ever sees
+// available dishes.
+func parseQueryFilter(r *http.Request, role users.Role) (QueryFilter, error) {
+	query := r.URL.Query()
+	filter := QueryFilter{
+		Search:   strings.TrimSpace(query.Get("q")),
+		Category: strings.TrimSpace(query.Get("category")),
+	}
+
+	if !role.Can(rbac.PermDishReadAll) {
+		available := true
+		filter.Available = &available
+	} else if raw := query.Get("available"); raw != "" {
+		available, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid available parameter")
+		}
+		filter.Available = &available
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid page parameter")
+		}
+		filter.Page = page
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid limit parameter")
+		}
+		filter.Limit = limit
+	}
+
+	if raw := query.Get("category_id"); raw != "" {
+		categoryID, err := uuid.Parse(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid category_id parameter")
+		}
+		filter.CategoryID = &categoryID
+	}
+
+	if raw := query.Get("min_price"); raw != "" {
+		price, err := decimal.NewFromString(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid min_price parameter")
+		}
+		filter.MinPrice = &price
+	}
+
+	if raw := query.Get("max_price"); raw != "" {
+		price, err := decimal.NewFromString(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid max_price parameter")
+		}
+		filter.MaxPrice = &price
+	}
+
+	if raw := query.Get("sort"); raw != "" {
+		field, desc := strings.CutPrefix(raw, "-")
+		if _, ok := SortFields[field]; !ok {
+			return filter, fmt.Errorf("invalid sort parameter, must be one of name, price or created_at")
+		}
+		filter.Sort = field
+		filter.Desc = desc
+	}
+
+	filter.Normalize()
+
+	return filter, nil
+}
+
+func (h *DishHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idRaw := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[UpdateRequest](r)
 	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.Update(ctx, id, body); err != nil {
 		if errors.Is(err, ErrDishNotFound) {
 			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
 				"error": "dish not found",
@@ -140,49 +328,87 @@ func (h *DishHandler) Query(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if errors.Is(err, ErrCategoryNotFound) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": "category not found",
+			})
+			return
+		}
+
 		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
 			"error": "unexpected internal server error",
 		})
 		return
 	}
 
-	response := make([]DishResponse, len(records))
-	for i, record := range records {
-		response[i] = DishResponse{
-			ID:          record.ID.String(),
-			Name:        record.Name,
-			Description: record.Description,
-			Price:       record.Price.String(),
-			Category:    record.Category,
-			CreatedAt:   record.CreatedAt,
-			UpdatedAt:   record.UpdatedAt,
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "dish updated with success",
+	})
+}
+
+func (h *DishHandler) SetAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[AvailabilityRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.SetAvailability(ctx, id, *body.Available); err != nil {
+		if errors.Is(err, ErrDishNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "dish not found",
+			})
+			return
 		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
 	}
 
-	jsonutils.EncodeJson(w, http.StatusOK, map[string][]DishResponse{
-		"dishes": response,
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "dish availability updated with success",
 	})
 }
 
-func (h *DishHandler) Update(w http.ResponseWriter, r *http.Request) {
+func (h *DishHandler) SetStock(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	role, ok := ctx.Value(middleware.CtxUserRole).(string)
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
 	if !ok {
 		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
-			"error": "user role not found",
+			"error": "user id not found",
 		})
 		return
 	}
 
-	if role != string(users.RoleAdmin) {
-		jsonutils.EncodeJson(w, http.StatusForbidden, map[string]string{
-			"error": "forbidden: admin only",
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
 		})
 		return
 	}
 
-	idRaw := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idRaw)
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
 		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
 			"error": "invalid uuid type",
@@ -190,7 +416,7 @@ func (h *DishHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := jsonutils.DecodeJson[UpdateRequest](r)
+	body, err := jsonutils.DecodeJson[SetStockRequest](r)
 	if err != nil {
 		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
 			"error": "invalid body request",
@@ -205,7 +431,7 @@ func (h *DishHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.s.Update(ctx, id, body); err != nil {
+	if err := h.s.SetStock(ctx, id, userID, body.Stock, body.Note); err != nil {
 		if errors.Is(err, ErrDishNotFound) {
 			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
 				"error": "dish not found",
@@ -220,27 +446,127 @@ func (h *DishHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
-		"success": "dish updated with success",
+		"success": "dish stock updated with success",
 	})
 }
 
-func (h *DishHandler) Delete(w http.ResponseWriter, r *http.Request) {
+func (h *DishHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	role, ok := ctx.Value(middleware.CtxUserRole).(string)
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
 	if !ok {
 		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
-			"error": "user role not found",
+			"error": "user id not found",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[AdjustStockRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	movement, err := h.s.AdjustStock(ctx, id, userID, body.Delta, body.Note)
+	if err != nil {
+		if errors.Is(err, ErrDishNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "dish not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrStockNotTracked) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusCreated, map[string]StockMovementResponse{
+		"movement": NewStockMovementResponse(movement),
+	})
+}
+
+func (h *DishHandler) QueryMovements(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	role, _ := ctx.Value(middleware.CtxUserRole).(string)
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
 		})
 		return
 	}
 
-	if role != string(users.RoleAdmin) {
-		jsonutils.EncodeJson(w, http.StatusForbidden, map[string]string{
-			"error": "forbidden: admin only",
+	filter, err := parseQueryFilter(r, users.Role(role))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
 		})
 		return
 	}
 
+	records, total, err := h.s.QueryMovements(ctx, id, filter.Page, filter.Limit)
+	if err != nil {
+		if errors.Is(err, ErrDishNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "dish not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	response := ListMovementsResponse{
+		Movements: make([]StockMovementResponse, len(records)),
+		Page:      filter.Page,
+		Limit:     filter.Limit,
+		Total:     total,
+	}
+	for i := range records {
+		response.Movements[i] = NewStockMovementResponse(&records[i])
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, response)
+}
+
+func (h *DishHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	idRaw := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idRaw)
 	if err != nil {
@@ -0,0 +1,136 @@
+package dishes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/categories"
+	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/users"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// MockCategories only implements the category lookup used by the dish
+// service; calling any other method panics.
+type MockCategories struct {
+	categories.Repository
+	category *categories.Category
+}
+
+func (m *MockCategories) GetOneByID(ctx context.Context, id uuid.UUID) (*categories.Category, error) {
+	if m.category == nil || m.category.ID != id {
+		return nil, categories.ErrCategoryNotFound
+	}
+	return m.category, nil
+}
+
+// withRoute adds the chi URL params and the caller's role, as the router and
+// the auth middleware would.
+func withRoute(r *http.Request, role users.Role, params map[string]string) *http.Request {
+	routeCtx := chi.NewRouteContext()
+	for key, value := range params {
+		routeCtx.URLParams.Add(key, value)
+	}
+
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+	if role != "" {
+		ctx = context.WithValue(ctx, middleware.CtxUserRole, string(role))
+	}
+	return r.WithContext(ctx)
+}
+
+// TESTS
+
+func TestCreateHandler(t *testing.T) {
+	category := &categories.Category{ID: uuid.New(), Name: "Pratos principais"}
+	mockRepo := &MockRepository{
+		createFunc: func(ctx context.Context, dish *Dish) error {
+			dish.ID = uuid.New()
+			return nil
+		},
+	}
+
+	h := NewDishHandler(NewDishService(mockRepo, &MockCategories{category: category}), nil)
+
+	t.Run("should return the created dish", func(t *testing.T) {
+		body := `{"name": "Feijoada", "description": "Feijoada completa", "price": 59.9, "category_id": "` + category.ID.String() + `"}`
+		rec := httptest.NewRecorder()
+		h.Create(rec, httptest.NewRequest(http.MethodPost, "/dishes", strings.NewReader(body)))
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var response map[string]DishResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("expected json body, got %v", err)
+		}
+
+		dish, ok := response["dish"]
+		if !ok || dish.Name != "Feijoada" || dish.ID == "" {
+			t.Errorf("expected the created dish, got %+v", response)
+		}
+	})
+
+	t.Run("should reject an unknown category", func(t *testing.T) {
+		body := `{"name": "Feijoada", "description": "Feijoada completa", "price": 59.9, "category_id": "` + uuid.NewString() + `"}`
+		rec := httptest.NewRecorder()
+		h.Create(rec, httptest.NewRequest(http.MethodPost, "/dishes", strings.NewReader(body)))
+
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", rec.Code)
+		}
+	})
+}
+
+func TestGetOneHandler(t *testing.T) {
+	available := &Dish{ID: uuid.New(), Name: "Feijoada", Available: true}
+	hidden := &Dish{ID: uuid.New(), Name: "Moqueca", Available: false}
+
+	mockRepo := &MockRepository{
+		getOneByIDFunc: func(ctx context.Context, id uuid.UUID) (*Dish, error) {
+			for _, dish := range []*Dish{available, hidden} {
+				if dish.ID == id {
+					return dish, nil
+				}
+			}
+			return nil, ErrDishNotFound
+		},
+	}
+
+	h := NewDishHandler(NewDishService(mockRepo, nil), nil)
+
+	get := func(id uuid.UUID, role users.Role) int {
+		r := httptest.NewRequest(http.MethodGet, "/dishes/"+id.String(), nil)
+		rec := httptest.NewRecorder()
+		h.GetOne(rec, withRoute(r, role, map[string]string{"id": id.String()}))
+		return rec.Code
+	}
+
+	t.Run("should return available dishes to anyone", func(t *testing.T) {
+		for _, role := range []users.Role{"", users.RoleClient, users.RoleManager} {
+			if code := get(available.ID, role); code != http.StatusOK {
+				t.Errorf("role %q: expected 200, got %d", role, code)
+			}
+		}
+	})
+
+	t.Run("should hide unavailable dishes from clients", func(t *testing.T) {
+		for _, role := range []users.Role{"", users.RoleClient} {
+			if code := get(hidden.ID, role); code != http.StatusNotFound {
+				t.Errorf("role %q: expected 404, got %d", role, code)
+			}
+		}
+	})
+
+	t.Run("should show unavailable dishes to staff", func(t *testing.T) {
+		if code := get(hidden.ID, users.RoleManager); code != http.StatusOK {
+			t.Errorf("expected 200, got %d", code)
+		}
+	})
+}
@@ -3,16 +3,67 @@ package dishes
 import (
 	"time"
 
+	"github.com/EduardoMark/gastro-api/internal/categories"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
+// Dish keeps a copy of its category name in Category so full-text search and
+// responses do not need a join; the categories repository keeps it in sync.
+//
+// Dishes are soft deleted so past orders keep pointing at them. Available is
+// independent of deletion and lets staff hide a dish the kitchen ran out of.
+// Stock is nil for dishes whose stock is not tracked; tracked dishes become
+// unavailable automatically when their stock reaches zero.
 type Dish struct {
-	ID          uuid.UUID       `json:"id" gorm:"default:gen_random_uuid();primary key"`
-	Name        string          `json:"name" gorm:"varchar(100);not null;unique"`
-	Description string          `json:"description" gorm:"text;not null"`
-	Price       decimal.Decimal `json:"price" gorm:"type:numeric(10,2);not null"`
-	Category    string          `json:"category" gorm:"type:varchar(100);not null"`
-	CreatedAt   time.Time       `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+	ID          uuid.UUID            `json:"id" gorm:"default:gen_random_uuid();primary key"`
+	Name        string               `json:"name" gorm:"type:varchar(100);not null;uniqueIndex:idx_dishes_name_active,where:deleted_at IS NULL"`
+	Description string               `json:"description" gorm:"text;not null"`
+	Price       decimal.Decimal      `json:"price" gorm:"type:numeric(10,2);not null"`
+	Category    string               `json:"category" gorm:"type:varchar(100);not null"`
+	CategoryID  *uuid.UUID           `json:"category_id" gorm:"type:uuid;index"`
+	CategoryRef *categories.Category `json:"-" gorm:"foreignKey:CategoryID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Available   bool                 `json:"available" gorm:"not null;default:true"`
+	Stock       *int                 `json:"stock" gorm:"check:chk_dishes_stock_non_negative,stock >= 0"`
+	CreatedAt   time.Time            `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time            `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt       `json:"-" gorm:"index"`
+}
+
+// stockAvailability returns the availability a tracked dish gets when its
+// stock goes from before to after: it sells out at zero and becomes available
+// again once restocked. nil leaves the availability set by staff untouched.
+func stockAvailability(before, after int) *bool {
+	switch {
+	case after <= 0:
+		available := false
+		return &available
+	case before <= 0:
+		available := true
+		return &available
+	}
+	return nil
+}
+
+type StockReason string
+
+const (
+	StockReasonOrder        StockReason = "order"
+	StockReasonCancellation StockReason = "cancellation"
+	StockReasonAdjustment   StockReason = "adjustment"
+)
+
+// StockMovement is an entry of the stock ledger. Delta is negative when stock
+// leaves (orders) and positive when it comes back or is restocked.
+type StockMovement struct {
+	ID         uuid.UUID   `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	DishID     uuid.UUID   `json:"dish_id" gorm:"type:uuid;not null;index"`
+	Delta      int         `json:"delta" gorm:"not null"`
+	StockAfter int         `json:"stock_after" gorm:"not null"`
+	Reason     StockReason `json:"reason" gorm:"type:varchar(50);not null"`
+	OrderID    *uuid.UUID  `json:"order_id" gorm:"type:uuid;index"`
+	UserID     *uuid.UUID  `json:"user_id" gorm:"type:uuid"`
+	Note       string      `json:"note" gorm:"type:text"`
+	CreatedAt  time.Time   `json:"created_at" gorm:"autoCreateTime"`
 }
@@ -4,18 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
 	Create(ctx context.Context, dish *Dish) error
 	GetOneByID(ctx context.Context, id uuid.UUID) (*Dish, error)
 	GetOneByName(ctx context.Context, name string) (*Dish, error)
-	Query(ctx context.Context) ([]*Dish, error)
+	GetManyByIDs(ctx context.Context, ids []uuid.UUID) ([]*Dish, error)
+	Query(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error)
+	Search(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error)
 	Update(ctx context.Context, dish *Dish) error
+	UpdateAvailability(ctx context.Context, id uuid.UUID, available bool) error
+	AdjustStock(ctx context.Context, movement *StockMovement) error
+	SetStock(ctx context.Context, id uuid.UUID, stock *int, movement *StockMovement) error
+	QueryMovements(ctx context.Context, dishID uuid.UUID, page, limit int) ([]StockMovement, int64, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -31,6 +39,9 @@ func NewDishRepository(db *gorm.DB) Repository {
 
 var ErrDishAlreadyExists = errors.New("dish already exists")
 var ErrDishNotFound = errors.New("dish not found")
+var ErrCategoryNotFound = errors.New("category not found")
+var ErrInsufficientStock = errors.New("insufficient stock")
+var ErrStockNotTracked = errors.New("stock is not tracked for this dish")
 
 func (r *dishRepository) Create(ctx context.Context, dish *Dish) error {
 	err := r.db.WithContext(ctx).Create(dish).Error
@@ -76,21 +87,112 @@ func (r *dishRepository) GetOneByName(ctx context.Context, name string) (*Dish,
 	return &dish, nil
 }
 
-func (r *dishRepository) Query(ctx context.Context) ([]*Dish, error) {
+// GetManyByIDs loads every dish whose id is in ids with a single query. Ids
+// that do not match a dish, including deleted ones, are simply absent from
+// the result.
+func (r *dishRepository) GetManyByIDs(ctx context.Context, ids []uuid.UUID) ([]*Dish, error) {
 	var dishes []*Dish
 
-	err := r.db.WithContext(ctx).Find(&dishes).Error
-	if err != nil {
-		return nil, fmt.Errorf("Query - failed find all dishes: %v", err)
+	if len(ids) == 0 {
+		return dishes, nil
 	}
 
-	if len(dishes) == 0 {
-		return nil, ErrDishNotFound
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&dishes).Error
+	if err != nil {
+		return nil, fmt.Errorf("GetManyByIDs - failed to get dishes: %v", err)
 	}
 
 	return dishes, nil
 }
 
+func (r *dishRepository) Query(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+	var dishes []*Dish
+	var total int64
+
+	query := applyFilters(r.db.WithContext(ctx).Model(&Dish{}), filter)
+
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Search) + "%"
+		query = query.Where("name ILIKE ? OR description ILIKE ?", pattern, pattern)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("Query - failed to count dishes: %v", err)
+	}
+
+	err := query.
+		Order(clause.OrderByColumn{Column: clause.Column{Name: SortFields[filter.Sort]}, Desc: filter.Desc}).
+		Order("id").
+		Limit(filter.Limit).
+		Offset((filter.Page - 1) * filter.Limit).
+		Find(&dishes).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("Query - failed find all dishes: %v", err)
+	}
+
+	return dishes, total, nil
+}
+
+// searchQuery turns the user input into a tsquery. It uses the same
+// configuration and unaccent wrapper as the dishes.search_vector column.
+const searchQuery = "websearch_to_tsquery('portuguese', immutable_unaccent(?))"
+
+// Search runs a full-text search over name, category and description,
+// ignoring accents, and orders the results by relevance.
+func (r *dishRepository) Search(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+	var dishes []*Dish
+	var total int64
+
+	query := applyFilters(r.db.WithContext(ctx).Model(&Dish{}), filter).
+		Where("search_vector @@ "+searchQuery, filter.Search)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("Search - failed to count dishes: %v", err)
+	}
+
+	err := query.
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "ts_rank(search_vector, " + searchQuery + ") DESC, name",
+			Vars:               []any{filter.Search},
+			WithoutParentheses: true,
+		}}).
+		Limit(filter.Limit).
+		Offset((filter.Page - 1) * filter.Limit).
+		Find(&dishes).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("Search - failed to search dishes: %v", err)
+	}
+
+	return dishes, total, nil
+}
+
+// applyFilters adds the category and price conditions shared by Query and
+// Search.
+func applyFilters(query *gorm.DB, filter QueryFilter) *gorm.DB {
+	if filter.Category != "" {
+		query = query.Where("LOWER(category) = LOWER(?)", filter.Category)
+	}
+	if filter.CategoryID != nil {
+		query = query.Where("category_id = ?", *filter.CategoryID)
+	}
+	if filter.Available != nil {
+		query = query.Where("available = ?", *filter.Available)
+	}
+	if filter.MinPrice != nil {
+		query = query.Where("price >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		query = query.Where("price <= ?", *filter.MaxPrice)
+	}
+
+	return query
+}
+
+// likeEscaper escapes the LIKE wildcards so user input is matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func (r *dishRepository) Update(ctx context.Context, dish *Dish) error {
 	result := r.db.WithContext(ctx).Model(Dish{}).Where("id = ?", dish.ID).Updates(dish)
 	if result.Error != nil {
@@ -104,6 +206,150 @@ func (r *dishRepository) Update(ctx context.Context, dish *Dish) error {
 	return nil
 }
 
+func (r *dishRepository) UpdateAvailability(ctx context.Context, id uuid.UUID, available bool) error {
+	result := r.db.WithContext(ctx).Model(&Dish{}).Where("id = ?", id).Update("available", available)
+	if result.Error != nil {
+		return fmt.Errorf("UpdateAvailability - failed to update dish: %v", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrDishNotFound
+	}
+
+	return nil
+}
+
+// AdjustStock applies movement.Delta to the stock of movement.DishID and
+// appends the movement to the ledger, filling in StockAfter. The update is a
+// single conditional statement, so concurrent orders can never take the stock
+// below zero. The dish is marked unavailable when it reaches zero and
+// available again when a restock or a cancellation brings it back.
+func (r *dishRepository) AdjustStock(ctx context.Context, movement *StockMovement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var stock []int
+
+		err := tx.Raw(`
+			UPDATE dishes
+			SET stock = stock + ?, updated_at = NOW()
+			WHERE id = ? AND deleted_at IS NULL AND stock IS NOT NULL AND stock + ? >= 0
+			RETURNING stock`,
+			movement.Delta, movement.DishID, movement.Delta,
+		).Scan(&stock).Error
+		if err != nil {
+			return fmt.Errorf("AdjustStock - failed to update stock: %v", err)
+		}
+
+		if len(stock) == 0 {
+			var dish Dish
+			if err := tx.Where("id = ?", movement.DishID).First(&dish).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrDishNotFound
+				}
+				return fmt.Errorf("AdjustStock - failed to get dish: %v", err)
+			}
+
+			if dish.Stock == nil {
+				return ErrStockNotTracked
+			}
+
+			return ErrInsufficientStock
+		}
+
+		movement.StockAfter = stock[0]
+
+		if available := stockAvailability(stock[0]-movement.Delta, stock[0]); available != nil {
+			err := tx.Model(&Dish{}).Where("id = ?", movement.DishID).Update("available", *available).Error
+			if err != nil {
+				return fmt.Errorf("AdjustStock - failed to update availability: %v", err)
+			}
+		}
+
+		if err := tx.Create(movement).Error; err != nil {
+			return fmt.Errorf("AdjustStock - failed to save stock movement: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// SetStock overwrites the stock of a dish. A nil stock stops tracking it. The
+// difference with the previous stock is recorded in the ledger as movement.
+func (r *dishRepository) SetStock(ctx context.Context, id uuid.UUID, stock *int, movement *StockMovement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var dish Dish
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&dish).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDishNotFound
+			}
+			return fmt.Errorf("SetStock - failed to get dish: %v", err)
+		}
+
+		columns := map[string]any{"stock": stock}
+		if stock != nil {
+			// A dish that starts being tracked keeps its availability unless
+			// it starts at zero.
+			before := *stock
+			if dish.Stock != nil {
+				before = *dish.Stock
+			}
+
+			if available := stockAvailability(before, *stock); available != nil {
+				columns["available"] = *available
+			}
+		}
+
+		if err := tx.Model(&Dish{}).Where("id = ?", id).Updates(columns).Error; err != nil {
+			return fmt.Errorf("SetStock - failed to update stock: %v", err)
+		}
+
+		if stock == nil {
+			return nil
+		}
+
+		before := 0
+		if dish.Stock != nil {
+			before = *dish.Stock
+		}
+
+		movement.DishID = id
+		movement.Delta = *stock - before
+		movement.StockAfter = *stock
+
+		if err := tx.Create(movement).Error; err != nil {
+			return fmt.Errorf("SetStock - failed to save stock movement: %v", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *dishRepository) QueryMovements(ctx context.Context, dishID uuid.UUID, page, limit int) ([]StockMovement, int64, error) {
+	var movements []StockMovement
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&StockMovement{}).Where("dish_id = ?", dishID)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("QueryMovements - failed to count stock movements: %v", err)
+	}
+
+	err := query.
+		Order("created_at DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Find(&movements).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("QueryMovements - failed to find stock movements: %v", err)
+	}
+
+	return movements, total, nil
+}
+
+// Delete soft deletes the dish; it disappears from the menu but stays
+// referenced by the orders that contain it.
 func (r *dishRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	result := r.db.WithContext(ctx).Model(Dish{}).Where("id = ?", id).Delete(nil)
 
@@ -2,48 +2,67 @@ package dishes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/EduardoMark/gastro-api/internal/categories"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type Service interface {
-	Create(ctx context.Context, name, description, category string, price float64) error
+	Create(ctx context.Context, name, description string, categoryID uuid.UUID, price float64) (*Dish, error)
 	GetOneByID(ctx context.Context, id uuid.UUID) (*Dish, error)
-	Query(ctx context.Context) ([]*Dish, error)
+	Query(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error)
+	Search(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error)
 	Update(ctx context.Context, id uuid.UUID, req UpdateRequest) error
+	SetAvailability(ctx context.Context, id uuid.UUID, available bool) error
+	SetStock(ctx context.Context, id, userID uuid.UUID, stock *int, note string) error
+	AdjustStock(ctx context.Context, id, userID uuid.UUID, delta int, note string) (*StockMovement, error)
+	QueryMovements(ctx context.Context, id uuid.UUID, page, limit int) ([]StockMovement, int64, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
 type dishService struct {
-	r Repository
+	r          Repository
+	categories categories.Repository
 }
 
-func NewDishService(r Repository) Service {
+func NewDishService(r Repository, categories categories.Repository) Service {
 	return &dishService{
-		r: r,
+		r:          r,
+		categories: categories,
 	}
 }
 
-func (s *dishService) Create(ctx context.Context, name, description, category string, price float64) error {
+var ErrEmptySearch = errors.New("search query is required")
+
+func (s *dishService) Create(ctx context.Context, name, description string, categoryID uuid.UUID, price float64) (*Dish, error) {
 	decimalPrice, err := decimal.NewFromString(fmt.Sprintf("%.2f", price))
 	if err != nil {
-		return fmt.Errorf("failed to convert price to decimal price: %v", err)
+		return nil, fmt.Errorf("failed to convert price to decimal price: %v", err)
+	}
+
+	category, err := s.getCategory(ctx, categoryID)
+	if err != nil {
+		return nil, err
 	}
 
 	dish := Dish{
 		Name:        name,
 		Description: description,
-		Category:    category,
+		Category:    category.Name,
+		CategoryID:  &category.ID,
 		Price:       decimalPrice,
+		Available:   true,
 	}
 
 	if err := s.r.Create(ctx, &dish); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &dish, nil
 }
 
 func (s *dishService) GetOneByID(ctx context.Context, id uuid.UUID) (*Dish, error) {
@@ -55,13 +74,31 @@ func (s *dishService) GetOneByID(ctx context.Context, id uuid.UUID) (*Dish, erro
 	return record, nil
 }
 
-func (s *dishService) Query(ctx context.Context) ([]*Dish, error) {
-	records, err := s.r.Query(ctx)
+func (s *dishService) Query(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+	filter.Normalize()
+
+	records, total, err := s.r.Query(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return records, nil
+	return records, total, nil
+}
+
+func (s *dishService) Search(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+	filter.Search = strings.TrimSpace(filter.Search)
+	if filter.Search == "" {
+		return nil, 0, ErrEmptySearch
+	}
+
+	filter.Normalize()
+
+	records, total, err := s.r.Search(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
 }
 
 func (s *dishService) Update(ctx context.Context, id uuid.UUID, req UpdateRequest) error {
@@ -70,12 +107,23 @@ func (s *dishService) Update(ctx context.Context, id uuid.UUID, req UpdateReques
 		return fmt.Errorf("failed to convert price to decimal price: %v", err)
 	}
 
+	categoryID, err := uuid.Parse(req.CategoryID)
+	if err != nil {
+		return ErrCategoryNotFound
+	}
+
+	category, err := s.getCategory(ctx, categoryID)
+	if err != nil {
+		return err
+	}
+
 	dish := Dish{
 		ID:          id,
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       decimalPrice,
-		Category:    req.Category,
+		Category:    category.Name,
+		CategoryID:  &category.ID,
 	}
 
 	if err := s.r.Update(ctx, &dish); err != nil {
@@ -85,6 +133,60 @@ func (s *dishService) Update(ctx context.Context, id uuid.UUID, req UpdateReques
 	return nil
 }
 
+func (s *dishService) SetAvailability(ctx context.Context, id uuid.UUID, available bool) error {
+	if err := s.r.UpdateAvailability(ctx, id, available); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *dishService) SetStock(ctx context.Context, id, userID uuid.UUID, stock *int, note string) error {
+	movement := StockMovement{
+		Reason: StockReasonAdjustment,
+		UserID: &userID,
+		Note:   note,
+	}
+
+	if err := s.r.SetStock(ctx, id, stock, &movement); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *dishService) AdjustStock(ctx context.Context, id, userID uuid.UUID, delta int, note string) (*StockMovement, error) {
+	movement := StockMovement{
+		DishID: id,
+		Delta:  delta,
+		Reason: StockReasonAdjustment,
+		UserID: &userID,
+		Note:   note,
+	}
+
+	if err := s.r.AdjustStock(ctx, &movement); err != nil {
+		return nil, err
+	}
+
+	return &movement, nil
+}
+
+func (s *dishService) QueryMovements(ctx context.Context, id uuid.UUID, page, limit int) ([]StockMovement, int64, error) {
+	if _, err := s.r.GetOneByID(ctx, id); err != nil {
+		return nil, 0, err
+	}
+
+	filter := QueryFilter{Page: page, Limit: limit}
+	filter.Normalize()
+
+	records, total, err := s.r.QueryMovements(ctx, id, filter.Page, filter.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
 func (s *dishService) Delete(ctx context.Context, id uuid.UUID) error {
 	if err := s.r.Delete(ctx, id); err != nil {
 		return err
@@ -92,3 +194,15 @@ func (s *dishService) Delete(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+func (s *dishService) getCategory(ctx context.Context, id uuid.UUID) (*categories.Category, error) {
+	category, err := s.categories.GetOneByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, categories.ErrCategoryNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+
+	return category, nil
+}
@@ -0,0 +1,314 @@
+package dishes
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/users"
+	"github.com/google/uuid"
+)
+
+type MockRepository struct {
+	createFunc             func(ctx context.Context, dish *Dish) error
+	getOneByIDFunc         func(ctx context.Context, id uuid.UUID) (*Dish, error)
+	getOneByNameFunc       func(ctx context.Context, name string) (*Dish, error)
+	getManyByIDsFunc       func(ctx context.Context, ids []uuid.UUID) ([]*Dish, error)
+	queryFunc              func(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error)
+	searchFunc             func(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error)
+	updateFunc             func(ctx context.Context, dish *Dish) error
+	updateAvailabilityFunc func(ctx context.Context, id uuid.UUID, available bool) error
+	adjustStockFunc        func(ctx context.Context, movement *StockMovement) error
+	setStockFunc           func(ctx context.Context, id uuid.UUID, stock *int, movement *StockMovement) error
+	queryMovementsFunc     func(ctx context.Context, dishID uuid.UUID, page, limit int) ([]StockMovement, int64, error)
+	deleteFunc             func(ctx context.Context, id uuid.UUID) error
+}
+
+func (m *MockRepository) Create(ctx context.Context, dish *Dish) error {
+	if m.createFunc != nil {
+		return m.createFunc(ctx, dish)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetOneByID(ctx context.Context, id uuid.UUID) (*Dish, error) {
+	if m.getOneByIDFunc != nil {
+		return m.getOneByIDFunc(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetOneByName(ctx context.Context, name string) (*Dish, error) {
+	if m.getOneByNameFunc != nil {
+		return m.getOneByNameFunc(ctx, name)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetManyByIDs(ctx context.Context, ids []uuid.UUID) ([]*Dish, error) {
+	if m.getManyByIDsFunc != nil {
+		return m.getManyByIDsFunc(ctx, ids)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) Query(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx, filter)
+	}
+	return nil, 0, nil
+}
+
+func (m *MockRepository) Search(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+	if m.searchFunc != nil {
+		return m.searchFunc(ctx, filter)
+	}
+	return nil, 0, nil
+}
+
+func (m *MockRepository) Update(ctx context.Context, dish *Dish) error {
+	if m.updateFunc != nil {
+		return m.updateFunc(ctx, dish)
+	}
+	return nil
+}
+
+func (m *MockRepository) UpdateAvailability(ctx context.Context, id uuid.UUID, available bool) error {
+	if m.updateAvailabilityFunc != nil {
+		return m.updateAvailabilityFunc(ctx, id, available)
+	}
+	return nil
+}
+
+func (m *MockRepository) AdjustStock(ctx context.Context, movement *StockMovement) error {
+	if m.adjustStockFunc != nil {
+		return m.adjustStockFunc(ctx, movement)
+	}
+	return nil
+}
+
+func (m *MockRepository) SetStock(ctx context.Context, id uuid.UUID, stock *int, movement *StockMovement) error {
+	if m.setStockFunc != nil {
+		return m.setStockFunc(ctx, id, stock, movement)
+	}
+	return nil
+}
+
+func (m *MockRepository) QueryMovements(ctx context.Context, dishID uuid.UUID, page, limit int) ([]StockMovement, int64, error) {
+	if m.queryMovementsFunc != nil {
+		return m.queryMovementsFunc(ctx, dishID, page, limit)
+	}
+	return nil, 0, nil
+}
+
+func (m *MockRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if m.deleteFunc != nil {
+		return m.deleteFunc(ctx, id)
+	}
+	return nil
+}
+
+// TESTS
+
+func TestStockAvailability(t *testing.T) {
+	t.Run("should mark the dish unavailable when it sells out", func(t *testing.T) {
+		available := stockAvailability(1, 0)
+		if available == nil || *available {
+			t.Errorf("expected unavailable, got: %v", available)
+		}
+	})
+
+	t.Run("should mark the dish available when it is restocked", func(t *testing.T) {
+		for _, before := range []int{0, -2} {
+			available := stockAvailability(before, 3)
+			if available == nil || !*available {
+				t.Errorf("restock from %d: expected available, got: %v", before, available)
+			}
+		}
+	})
+
+	t.Run("should leave the availability alone while in stock", func(t *testing.T) {
+		if available := stockAvailability(5, 3); available != nil {
+			t.Errorf("expected no change, got: %v", *available)
+		}
+	})
+}
+
+func TestSetStockRequestValidate(t *testing.T) {
+	stock := 10
+	track := false
+
+	t.Run("should require the stock", func(t *testing.T) {
+		req := SetStockRequest{}
+		if err := req.Validate(); err == nil {
+			t.Error("expected an error for a missing stock")
+		}
+	})
+
+	t.Run("should stop tracking only when asked explicitly", func(t *testing.T) {
+		req := SetStockRequest{Track: &track}
+		if err := req.Validate(); err != nil {
+			t.Errorf("expected no error, but got: %v", err)
+		}
+	})
+
+	t.Run("should reject a stock when tracking stops", func(t *testing.T) {
+		req := SetStockRequest{Stock: &stock, Track: &track}
+		if err := req.Validate(); err == nil {
+			t.Error("expected an error for a stock sent with track false")
+		}
+	})
+
+	t.Run("should accept a stock", func(t *testing.T) {
+		req := SetStockRequest{Stock: &stock}
+		if err := req.Validate(); err != nil {
+			t.Errorf("expected no error, but got: %v", err)
+		}
+	})
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+
+	var received QueryFilter
+	mockRepo := &MockRepository{
+		queryFunc: func(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+			received = filter
+			return nil, 0, nil
+		},
+	}
+
+	s := NewDishService(mockRepo, nil)
+
+	t.Run("should fill in the default page, limit and sort", func(t *testing.T) {
+		if _, _, err := s.Query(ctx, QueryFilter{Page: -3}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if received.Page != 1 || received.Limit != DefaultPageLimit || received.Sort != "name" {
+			t.Errorf("expected page 1, limit %d and sort by name, got: %+v", DefaultPageLimit, received)
+		}
+	})
+
+	t.Run("should cap the limit", func(t *testing.T) {
+		if _, _, err := s.Query(ctx, QueryFilter{Page: 2, Limit: MaxPageLimit + 1}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if received.Page != 2 || received.Limit != MaxPageLimit {
+			t.Errorf("expected page 2 and limit %d, got: %+v", MaxPageLimit, received)
+		}
+	})
+
+	t.Run("should replace an unknown sort field", func(t *testing.T) {
+		if _, _, err := s.Query(ctx, QueryFilter{Sort: "name; DROP TABLE dishes", Desc: true}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if received.Sort != "name" || !received.Desc {
+			t.Errorf("expected descending sort by name, got: %+v", received)
+		}
+	})
+
+	t.Run("should keep a valid sort field", func(t *testing.T) {
+		if _, _, err := s.Query(ctx, QueryFilter{Sort: "price"}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if received.Sort != "price" {
+			t.Errorf("expected sort by price, got: %+v", received)
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should return ErrEmptySearch for a blank query", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			searchFunc: func(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+				t.Fatal("repository should not be called")
+				return nil, 0, nil
+			},
+		}
+
+		s := NewDishService(mockRepo, nil)
+
+		for _, search := range []string{"", "   "} {
+			if _, _, err := s.Search(ctx, QueryFilter{Search: search}); !errors.Is(err, ErrEmptySearch) {
+				t.Errorf("search %q: expected ErrEmptySearch, got: %v", search, err)
+			}
+		}
+	})
+
+	t.Run("should search with a trimmed and normalized filter", func(t *testing.T) {
+		var received QueryFilter
+		mockRepo := &MockRepository{
+			searchFunc: func(ctx context.Context, filter QueryFilter) ([]*Dish, int64, error) {
+				received = filter
+				return nil, 0, nil
+			},
+		}
+
+		s := NewDishService(mockRepo, nil)
+
+		if _, _, err := s.Search(ctx, QueryFilter{Search: "  pizza ", Limit: 1000}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if received.Search != "pizza" || received.Page != 1 || received.Limit != MaxPageLimit {
+			t.Errorf("unexpected filter: %+v", received)
+		}
+	})
+}
+
+func TestParseQueryFilter(t *testing.T) {
+	t.Run("should parse sort, page and limit", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/dishes?sort=-price&page=3&limit=500", nil)
+
+		filter, err := parseQueryFilter(r, users.RoleManager)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if filter.Sort != "price" || !filter.Desc || filter.Page != 3 || filter.Limit != MaxPageLimit {
+			t.Errorf("unexpected filter: %+v", filter)
+		}
+	})
+
+	t.Run("should reject invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"sort=password", "sort=-", "page=first", "limit=ten", "available=maybe", "category_id=1", "min_price=cheap"} {
+			r := httptest.NewRequest("GET", "/dishes?"+query, nil)
+			if _, err := parseQueryFilter(r, users.RoleManager); err == nil {
+				t.Errorf("expected an error for %s", query)
+			}
+		}
+	})
+
+	t.Run("should only show available dishes to clients", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/dishes?available=false", nil)
+
+		filter, err := parseQueryFilter(r, users.RoleClient)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if filter.Available == nil || !*filter.Available {
+			t.Errorf("expected available dishes only, got: %+v", filter.Available)
+		}
+	})
+
+	t.Run("should let staff filter on availability", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/dishes?available=false", nil)
+
+		filter, err := parseQueryFilter(r, users.RoleManager)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if filter.Available == nil || *filter.Available {
+			t.Errorf("expected unavailable dishes, got: %+v", filter.Available)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/EduardoMark/gastro-api/internal/broker"
+	"github.com/EduardoMark/gastro-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// DatabaseCheck pings the connection pool.
+func DatabaseCheck(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// MigrationsCheck fails while migrations are pending. A database migrated by
+// a newer version is accepted, so instances of the previous version keep
+// serving during a rolling deploy.
+func MigrationsCheck(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		pending, err := database.Pending(ctx, db)
+		if err != nil && !errors.Is(err, database.ErrUnknownMigrations) {
+			return err
+		}
+
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations", len(pending))
+		}
+		return nil
+	}
+}
+
+// BrokerCheck fails once the event broker feeding the kitchen streams is
+// closed.
+func BrokerCheck(b *broker.Broker) Check {
+	return func(ctx context.Context) error {
+		if b.Closed() {
+			return errors.New("event broker closed")
+		}
+		return nil
+	}
+}
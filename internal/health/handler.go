@@ -0,0 +1,106 @@
+// Package health serves the probes used by the orchestrator: liveness,
+// readiness and the build the process runs.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/buildinfo"
+	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
+	"github.com/go-chi/chi/v5"
+)
+
+// checkTimeout bounds each readiness check, so a hanging dependency makes
+// the probe fail instead of time out.
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency the API needs is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type HealthHandler struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{}
+}
+
+// AddCheck registers a check run by the readiness probe.
+func (h *HealthHandler) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the readiness probe fail from now on, so the instance stops
+// receiving traffic while it shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *HealthHandler) HealthRoutes(r chi.Router) {
+	r.Get("/healthz", h.Live)
+	r.Get("/readyz", h.Ready)
+	r.Get("/version", h.Version)
+}
+
+type ReadyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Live only tells the process is serving requests. It does not look at
+// dependencies, so a database outage does not get every instance restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"status": "ok",
+	})
+}
+
+// Ready runs every check and fails when one of them does or when the
+// instance is shutting down.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		jsonutils.EncodeJson(w, http.StatusServiceUnavailable, ReadyResponse{Status: "draining"})
+		return
+	}
+
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	response := ReadyResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		err := c.check(ctx)
+		cancel()
+
+		if err != nil {
+			response.Checks[c.name] = err.Error()
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[c.name] = "ok"
+	}
+
+	jsonutils.EncodeJson(w, status, response)
+}
+
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	jsonutils.EncodeJson(w, http.StatusOK, buildinfo.Get())
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/broker"
+	"github.com/go-chi/chi/v5"
+)
+
+func newTestRouter(h *HealthHandler) http.Handler {
+	router := chi.NewRouter()
+	h.HealthRoutes(router)
+	return router
+}
+
+func get(t *testing.T, handler http.Handler, path string) (*httptest.ResponseRecorder, ReadyResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body ReadyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("expected json body, got %v", err)
+	}
+	return rec, body
+}
+
+// TESTS
+
+func TestHealthHandler(t *testing.T) {
+	t.Run("should report liveness without running checks", func(t *testing.T) {
+		h := NewHealthHandler()
+		h.AddCheck("database", func(ctx context.Context) error { return errors.New("down") })
+
+		rec, body := get(t, newTestRouter(h), "/healthz")
+		if rec.Code != http.StatusOK || body.Status != "ok" {
+			t.Errorf("expected 200 ok, got %d %+v", rec.Code, body)
+		}
+	})
+
+	t.Run("should be ready when every check passes", func(t *testing.T) {
+		h := NewHealthHandler()
+		h.AddCheck("database", func(ctx context.Context) error { return nil })
+		h.AddCheck("event_broker", BrokerCheck(broker.New()))
+
+		rec, body := get(t, newTestRouter(h), "/readyz")
+		if rec.Code != http.StatusOK || body.Status != "ok" {
+			t.Fatalf("expected 200 ok, got %d %+v", rec.Code, body)
+		}
+		if body.Checks["database"] != "ok" || body.Checks["event_broker"] != "ok" {
+			t.Errorf("unexpected checks %+v", body.Checks)
+		}
+	})
+
+	t.Run("should not be ready when a check fails", func(t *testing.T) {
+		b := broker.New()
+		b.Close()
+
+		h := NewHealthHandler()
+		h.AddCheck("database", func(ctx context.Context) error { return nil })
+		h.AddCheck("event_broker", BrokerCheck(b))
+
+		rec, body := get(t, newTestRouter(h), "/readyz")
+		if rec.Code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+			t.Fatalf("expected 503 unavailable, got %d %+v", rec.Code, body)
+		}
+		if body.Checks["event_broker"] != "event broker closed" || body.Checks["database"] != "ok" {
+			t.Errorf("unexpected checks %+v", body.Checks)
+		}
+	})
+
+	t.Run("should not be ready while draining", func(t *testing.T) {
+		h := NewHealthHandler()
+		h.AddCheck("database", func(ctx context.Context) error { return nil })
+		h.Drain()
+
+		rec, body := get(t, newTestRouter(h), "/readyz")
+		if rec.Code != http.StatusServiceUnavailable || body.Status != "draining" {
+			t.Errorf("expected 503 draining, got %d %+v", rec.Code, body)
+		}
+
+		rec, _ = get(t, newTestRouter(h), "/healthz")
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected liveness to keep passing, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should report the build", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newTestRouter(NewHealthHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+		var info struct {
+			Version   string `json:"version"`
+			GoVersion string `json:"go_version"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK || info.Version == "" || info.GoVersion == "" {
+			t.Errorf("unexpected version response %d %+v", rec.Code, info)
+		}
+	})
+}
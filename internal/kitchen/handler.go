@@ -0,0 +1,138 @@
+package kitchen
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/broker"
+	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// EventReset tells a reconnecting client that events it missed were lost and
+// it has to reload the orders.
+const EventReset = "reset"
+
+type KitchenHandler struct {
+	broker    *broker.Broker
+	jwt       *middleware.JWTMiddleware
+	heartbeat time.Duration
+}
+
+func NewKitchenHandler(broker *broker.Broker, jwt *middleware.JWTMiddleware) KitchenHandler {
+	return KitchenHandler{
+		broker:    broker,
+		jwt:       jwt,
+		heartbeat: heartbeatInterval,
+	}
+}
+
+func (h *KitchenHandler) KitchenRoutes(r chi.Router) {
+	r.Route("/kitchen", func(r chi.Router) {
+		r.Use(h.jwt.JWTAuth)
+		r.Use(middleware.RequirePermission(rbac.PermKitchenStream))
+
+		r.Get("/stream", h.Stream)
+	})
+}
+
+// Stream sends order events to the client as Server-Sent Events. Clients
+// reconnecting with a Last-Event-ID header (or last_event_id query parameter)
+// first receive the events they missed. When the broker no longer holds all
+// of them, a "reset" event is sent instead, carrying the id of the latest
+// event: the client must reload the orders, then keeps streaming from there.
+// A comment line is sent periodically to keep idle connections open.
+func (h *KitchenHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lastEventIDRaw := r.Header.Get("Last-Event-ID")
+	if lastEventIDRaw == "" {
+		lastEventIDRaw = r.URL.Query().Get("last_event_id")
+	}
+
+	var lastEventID uint64
+	if lastEventIDRaw != "" {
+		id, err := strconv.ParseUint(lastEventIDRaw, 10, 64)
+		if err != nil {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid last event id",
+			})
+			return
+		}
+		lastEventID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// The server write timeout would otherwise cut the stream.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logrus.WithError(err).Warn("kitchen stream: could not disable write deadline")
+	}
+
+	events, replay, unsubscribe := h.broker.Subscribe(lastEventID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if replay.Gap {
+		reset := broker.Event{ID: replay.LastID, Type: EventReset, Data: []byte(`{"reason":"missed events are no longer available"}`)}
+		if err := writeEvent(w, reset); err != nil {
+			return
+		}
+	} else {
+		for _, event := range replay.Events {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		logrus.WithError(err).Error("kitchen stream: response does not support flushing")
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				// Dropped for being too slow or the server is shutting down;
+				// the client reconnects and resumes from its last event id.
+				return
+			}
+
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event broker.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
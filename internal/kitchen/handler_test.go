@@ -0,0 +1,197 @@
+package kitchen
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/broker"
+)
+
+// sseBlock is one blank-line separated block of the stream: an event, or a
+// comment such as the heartbeat.
+type sseBlock struct {
+	id      string
+	event   string
+	data    string
+	comment string
+}
+
+// openStream starts the handler behind a test server and connects to it. The
+// server and the connection are closed when the test ends.
+func openStream(t *testing.T, h KitchenHandler, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(h.Stream))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	return bufio.NewReader(resp.Body)
+}
+
+// readBlock reads the next block of the stream, failing the test if none
+// arrives in time. ok is false once the stream ended.
+func readBlock(t *testing.T, stream *bufio.Reader) (block sseBlock, ok bool) {
+	t.Helper()
+
+	type result struct {
+		block sseBlock
+		ok    bool
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		var b sseBlock
+		read := false
+		for {
+			line, err := stream.ReadString('\n')
+			if err != nil {
+				done <- result{b, false}
+				return
+			}
+
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				if read {
+					done <- result{b, true}
+					return
+				}
+				continue
+			}
+			read = true
+
+			switch {
+			case strings.HasPrefix(line, ":"):
+				b.comment = strings.TrimSpace(strings.TrimPrefix(line, ":"))
+			case strings.HasPrefix(line, "id: "):
+				b.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				b.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				b.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	select {
+	case r := <-done:
+		return r.block, r.ok
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the stream")
+		return sseBlock{}, false
+	}
+}
+
+// TESTS
+
+func TestStream(t *testing.T) {
+	t.Run("should replay the events after the last event id", func(t *testing.T) {
+		b := broker.New()
+		for i := 0; i < 3; i++ {
+			b.Publish("order.created", i)
+		}
+
+		stream := openStream(t, NewKitchenHandler(b, nil), "1")
+
+		for _, id := range []string{"2", "3"} {
+			block, ok := readBlock(t, stream)
+			if !ok || block.id != id || block.event != "order.created" {
+				t.Fatalf("expected event %s to be replayed, got %+v", id, block)
+			}
+		}
+
+		b.Publish("order.updated", 3)
+
+		block, ok := readBlock(t, stream)
+		if !ok || block.id != "4" || block.event != "order.updated" {
+			t.Errorf("expected the live event 4, got %+v", block)
+		}
+	})
+
+	t.Run("should send a reset when missed events left the history", func(t *testing.T) {
+		b := broker.New()
+		for i := 0; i < broker.DefaultHistorySize+2; i++ {
+			b.Publish("order.created", i)
+		}
+
+		stream := openStream(t, NewKitchenHandler(b, nil), "1")
+
+		block, ok := readBlock(t, stream)
+		if !ok || block.event != EventReset || block.id != "258" {
+			t.Fatalf("expected a reset at event 258, got %+v", block)
+		}
+
+		b.Publish("order.created", 0)
+
+		block, ok = readBlock(t, stream)
+		if !ok || block.id != "259" || block.event != "order.created" {
+			t.Errorf("expected the live event 259 after the reset, got %+v", block)
+		}
+	})
+
+	t.Run("should reject an invalid last event id", func(t *testing.T) {
+		h := NewKitchenHandler(broker.New(), nil)
+
+		r := httptest.NewRequest(http.MethodGet, "/kitchen/stream", nil)
+		r.Header.Set("Last-Event-ID", "abc")
+		rec := httptest.NewRecorder()
+		h.Stream(rec, r)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should send heartbeats while idle", func(t *testing.T) {
+		h := NewKitchenHandler(broker.New(), nil)
+		h.heartbeat = 10 * time.Millisecond
+
+		stream := openStream(t, h, "")
+
+		block, ok := readBlock(t, stream)
+		if !ok || block.comment != "heartbeat" {
+			t.Errorf("expected a heartbeat, got %+v", block)
+		}
+	})
+
+	t.Run("should end the stream when the subscriber is dropped", func(t *testing.T) {
+		b := broker.New()
+		stream := openStream(t, NewKitchenHandler(b, nil), "")
+
+		// A subscriber that falls behind has its channel closed, just like
+		// on shutdown; the client then reconnects with its last event id.
+		for i := 0; i < broker.DefaultBufferSize*4; i++ {
+			b.Publish("order.created", i)
+		}
+		b.Close()
+
+		for {
+			if _, ok := readBlock(t, stream); !ok {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type LogMailer struct {
+	from string
+	dir  string
+}
+
+// NewLogMailer returns a mailer that logs messages instead of sending them.
+// When dir is not empty every message is also written there as an .eml file.
+func NewLogMailer(from, dir string) *LogMailer {
+	return &LogMailer{
+		from: from,
+		dir:  dir,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := validHeader(msg.To, msg.Subject); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info(msg.Body)
+
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(msg.To, "@", "_at_"))
+	if err := os.WriteFile(filepath.Join(m.dir, filepath.Base(name)), format(m.from, msg), 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+// Package mailer sends transactional emails such as password resets. The
+// SMTP implementation is used in production; the log implementation prints
+// messages and optionally writes them to disk for development and tests.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.Driver.
+func New(cfg config.Mail) Mailer {
+	if cfg.Driver == "smtp" {
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	}
+
+	return NewLogMailer(cfg.From, cfg.Dir)
+}
+
+// format renders msg as a plain text RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+// validHeader rejects values that would let a caller inject extra headers.
+func validHeader(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid header value %q", v)
+		}
+	}
+	return nil
+}
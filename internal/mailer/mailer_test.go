@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should write the message to the directory", func(t *testing.T) {
+		dir := t.TempDir()
+		m := NewLogMailer("noreply@gastro.test", dir)
+
+		err := m.Send(ctx, Message{To: "eduardo@email.com", Subject: "Hello", Body: "line 1\nline 2"})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("expected one file, got %d (%v)", len(entries), err)
+		}
+
+		data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+		if !strings.Contains(string(data), "Subject: Hello\r\n") || !strings.Contains(string(data), "line 1\r\nline 2") {
+			t.Errorf("unexpected message: %q", data)
+		}
+	})
+
+	t.Run("should reject header injection", func(t *testing.T) {
+		m := NewLogMailer("noreply@gastro.test", "")
+
+		err := m.Send(ctx, Message{To: "eduardo@email.com\r\nBcc: x@email.com", Subject: "Hello"})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	from   string
+	sender string
+}
+
+// NewSMTPMailer returns a mailer that delivers through the SMTP server at
+// host:port, authenticating with PLAIN auth when a username is given. from
+// may include a display name, e.g. "Gastro <noreply@example.com>".
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr:   net.JoinHostPort(host, port),
+		from:   from,
+		sender: from,
+	}
+
+	if addr, err := mail.ParseAddress(from); err == nil {
+		m.sender = addr.Address
+	}
+
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := validHeader(msg.To, msg.Subject); err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, m.sender, []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
@@ -7,23 +7,68 @@ import (
 	"strings"
 
 	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
 )
 
+// SessionChecker reports whether the session an access token belongs to is
+// still active, so revoked sessions are rejected before their tokens expire.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, userID, sessionID string) (bool, error)
+}
+
+// APIKeyPrincipal is who an API key acts as: the key's owner, limited to
+// the scopes the key was created with.
+type APIKeyPrincipal struct {
+	KeyID  string
+	UserID string
+	Role   string
+	Scopes []rbac.Permission
+}
+
+// APIKeyChecker resolves the API keys integrations send instead of access
+// tokens. Unknown, expired and revoked keys resolve to nil.
+type APIKeyChecker interface {
+	VerifyAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error)
+}
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs.
+const APIKeyPrefix = "gst_"
+
 type JWTMiddleware struct {
 	authService *auth.AuthJWTService
+	sessions    SessionChecker
+	apiKeys     APIKeyChecker
+	mfaRoles    map[string]bool
 }
 
-func NewJWTMiddleware(authService *auth.AuthJWTService) *JWTMiddleware {
-	return &JWTMiddleware{
+// NewJWTMiddleware builds the middleware. Callers whose role is in mfaRoles
+// must have logged in with a second factor to pass RequirePermission.
+func NewJWTMiddleware(authService *auth.AuthJWTService, sessions SessionChecker, apiKeys APIKeyChecker, mfaRoles []string) *JWTMiddleware {
+	m := &JWTMiddleware{
 		authService: authService,
+		sessions:    sessions,
+		apiKeys:     apiKeys,
+		mfaRoles:    map[string]bool{},
 	}
+
+	for _, role := range mfaRoles {
+		m.mfaRoles[role] = true
+	}
+
+	return m
 }
 
 type contentKey string
 
 const CtxUserId contentKey = "user_id"
 const CtxUserRole contentKey = "role"
+const CtxSessionID contentKey = "session_id"
+const CtxMFAMissing contentKey = "mfa_missing"
+const CtxAPIKeyID contentKey = "api_key_id"
+const CtxAPIKey contentKey = "api_key"
 
+// JWTAuth authenticates the bearer token of the request, which is either an
+// access token or an API key.
 func (m *JWTMiddleware) JWTAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -45,6 +90,11 @@ func (m *JWTMiddleware) JWTAuth(next http.Handler) http.Handler {
 		}
 
 		tokenStr := parts[1]
+		if strings.HasPrefix(tokenStr, APIKeyPrefix) {
+			m.apiKeyAuth(w, r, next, tokenStr)
+			return
+		}
+
 		claims, err := m.authService.VerifyToken(tokenStr)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -54,8 +104,71 @@ func (m *JWTMiddleware) JWTAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		active, err := m.sessions.SessionActive(r.Context(), claims.UserID, claims.SessionID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "unexpected internal server error",
+			})
+			return
+		}
+
+		if !active {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "session expired or revoked",
+			})
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), CtxUserId, claims.UserID)
 		ctx = context.WithValue(ctx, CtxUserRole, claims.Role)
+		ctx = context.WithValue(ctx, CtxSessionID, claims.SessionID)
+		ctx = context.WithValue(ctx, CtxMFAMissing, m.mfaRoles[claims.Role] && !claims.MFA)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// apiKeyAuth verifies the API key but does not authenticate the request as
+// its owner: it only stores the key's principal. RequirePermission grants the
+// owner's identity once the route's permissions are among the key's scopes,
+// so routes without a declared permission, such as changing the password or
+// listing one's orders, reject API keys. API keys are issued by admins, so
+// they are not subject to the second factor requirement of the owner's role.
+func (m *JWTMiddleware) apiKeyAuth(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	principal, err := m.apiKeys.VerifyAPIKey(r.Context(), key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	if principal == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "invalid, expired or revoked api key",
+		})
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), CtxAPIKey, principal)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// OptionalJWTAuth lets anonymous requests through untouched and otherwise
+// behaves like JWTAuth, so public routes can still tailor their response to
+// an authenticated caller.
+func (m *JWTMiddleware) OptionalJWTAuth(next http.Handler) http.Handler {
+	authenticated := m.JWTAuth(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,14 @@
+package middleware
+
+import "net/http"
+
+// MaxBodySize caps request bodies at n bytes. Reading past the limit fails,
+// so handlers reject oversized bodies as invalid without buffering them.
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
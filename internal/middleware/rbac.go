@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+)
+
+// RequirePermission rejects requests whose caller's role does not grant all
+// of perms, or whose role requires a second factor the caller did not log in
+// with. It must run after JWTAuth, which puts the role in the context.
+//
+// Requests made with an API key pass only when perms are all among the key's
+// scopes; the key's owner is then put in the context for the handler. An API
+// key is never accepted without at least one permission to check.
+func RequirePermission(perms ...rbac.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if key, ok := ctx.Value(CtxAPIKey).(*APIKeyPrincipal); ok {
+				if !rbac.Can(key.Role, perms...) {
+					forbidden(w, "forbidden: missing permission")
+					return
+				}
+
+				if len(perms) == 0 {
+					forbidden(w, "forbidden: api key scope missing")
+					return
+				}
+
+				for _, p := range perms {
+					if !slices.Contains(key.Scopes, p) {
+						forbidden(w, "forbidden: api key scope missing")
+						return
+					}
+				}
+
+				ctx = context.WithValue(ctx, CtxUserId, key.UserID)
+				ctx = context.WithValue(ctx, CtxUserRole, key.Role)
+				ctx = context.WithValue(ctx, CtxAPIKeyID, key.KeyID)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			role, ok := ctx.Value(CtxUserRole).(string)
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "user role not found",
+				})
+				return
+			}
+
+			if !rbac.Can(role, perms...) {
+				forbidden(w, "forbidden: missing permission")
+				return
+			}
+
+			if missing, _ := ctx.Value(CtxMFAMissing).(bool); missing {
+				forbidden(w, "forbidden: two-factor authentication required, enable it and log in again")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/EduardoMark/gastro-api/internal/config"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+)
+
+type MockSessions struct{}
+
+func (m *MockSessions) SessionActive(ctx context.Context, userID, sessionID string) (bool, error) {
+	return true, nil
+}
+
+type MockAPIKeys struct {
+	principal *APIKeyPrincipal
+}
+
+func (m *MockAPIKeys) VerifyAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error) {
+	if key != APIKeyPrefix+"valid" {
+		return nil, nil
+	}
+	return m.principal, nil
+}
+
+// whoAmI answers 200 with the user id the handler sees, or 401 without one,
+// like the handlers reading middleware.CtxUserId.
+var whoAmI = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(CtxUserId).(string)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Write([]byte(userID))
+})
+
+func newTestMiddleware(t *testing.T, principal *APIKeyPrincipal, mfaRoles ...string) (*JWTMiddleware, *auth.AuthJWTService) {
+	t.Helper()
+
+	authService, err := auth.NewAuthJWTService(config.Auth{
+		JWTIssuer:   "gastro-api",
+		JWTAudience: []string{"gastro-api"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewJWTMiddleware(authService, &MockSessions{}, &MockAPIKeys{principal: principal}, mfaRoles), authService
+}
+
+func serve(handler http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TESTS
+
+func TestRequirePermissionAPIKey(t *testing.T) {
+	principal := &APIKeyPrincipal{
+		KeyID:  "key-1",
+		UserID: "user-1",
+		Role:   rbac.RoleAdmin,
+		Scopes: []rbac.Permission{rbac.PermDishAvailability},
+	}
+
+	t.Run("should accept a key on a route whose permission is in its scopes", func(t *testing.T) {
+		m, _ := newTestMiddleware(t, principal)
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishAvailability)(whoAmI))
+
+		rec := serve(handler, APIKeyPrefix+"valid")
+		if rec.Code != http.StatusOK || rec.Body.String() != "user-1" {
+			t.Errorf("expected 200 as user-1, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("should reject a key missing the route's scope even if the role grants it", func(t *testing.T) {
+		m, _ := newTestMiddleware(t, principal)
+		handler := m.JWTAuth(RequirePermission(rbac.PermOrderCancelAny)(whoAmI))
+
+		if rec := serve(handler, APIKeyPrefix+"valid"); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should reject a scope the owner's role no longer grants", func(t *testing.T) {
+		waiter := *principal
+		waiter.Role = rbac.RoleWaiter
+		m, _ := newTestMiddleware(t, &waiter)
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishAvailability)(whoAmI))
+
+		if rec := serve(handler, APIKeyPrefix+"valid"); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should not authenticate a key on a route without a permission", func(t *testing.T) {
+		m, _ := newTestMiddleware(t, principal)
+
+		if rec := serve(m.JWTAuth(whoAmI), APIKeyPrefix+"valid"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without a user, got %d", rec.Code)
+		}
+
+		if rec := serve(m.JWTAuth(RequirePermission()(whoAmI)), APIKeyPrefix+"valid"); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403 without a declared permission, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should reject unknown keys", func(t *testing.T) {
+		m, _ := newTestMiddleware(t, principal)
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishAvailability)(whoAmI))
+
+		if rec := serve(handler, APIKeyPrefix+"unknown"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+}
+
+func TestRequirePermissionMFA(t *testing.T) {
+	t.Run("should reject a role requiring a second factor without one", func(t *testing.T) {
+		m, authService := newTestMiddleware(t, nil, rbac.RoleAdmin)
+		token, err := authService.New("user-1", rbac.RoleAdmin, "session-1", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishWrite)(whoAmI))
+		if rec := serve(handler, token); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+
+		if rec := serve(m.JWTAuth(whoAmI), token); rec.Code != http.StatusOK {
+			t.Errorf("expected routes without a permission to stay reachable, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should accept a role requiring a second factor with one", func(t *testing.T) {
+		m, authService := newTestMiddleware(t, nil, rbac.RoleAdmin)
+		token, err := authService.New("user-1", rbac.RoleAdmin, "session-1", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishWrite)(whoAmI))
+		if rec := serve(handler, token); rec.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should not require a second factor from other roles", func(t *testing.T) {
+		m, authService := newTestMiddleware(t, nil, rbac.RoleAdmin)
+		token, err := authService.New("user-2", rbac.RoleManager, "session-2", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishWrite)(whoAmI))
+		if rec := serve(handler, token); rec.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should reject roles lacking the permission", func(t *testing.T) {
+		m, authService := newTestMiddleware(t, nil)
+		token, err := authService.New("user-3", rbac.RoleClient, "session-3", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := m.JWTAuth(RequirePermission(rbac.PermDishWrite)(whoAmI))
+		if rec := serve(handler, token); rec.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rec.Code)
+		}
+	})
+}
@@ -2,13 +2,16 @@ package order
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/EduardoMark/gastro-api/internal/dishes"
 	"github.com/EduardoMark/gastro-api/internal/validation"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 type CreateOrderRequest struct {
-	Items []createOrderItems `json:"items" validete:"required,min=1"`
+	Items []createOrderItems `json:"items" validate:"required,min=1"`
 }
 
 type createOrderItems struct {
@@ -29,3 +32,145 @@ func (r *CreateOrderRequest) Validate() error {
 	}
 	return nil
 }
+
+type ItemsErrorResponse struct {
+	Error string      `json:"error"`
+	Items []ItemError `json:"items"`
+}
+
+type UpdateStatusRequest struct {
+	Status Status `json:"status" validate:"required"`
+}
+
+func (r *UpdateStatusRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+
+	if !r.Status.IsValid() {
+		return fmt.Errorf("field status must be a valid order status")
+	}
+
+	return nil
+}
+
+type CancelRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+func (r *CancelRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+		}
+	}
+
+	return nil
+}
+
+type StatusHistoryResponse struct {
+	FromStatus Status    `json:"from_status"`
+	ToStatus   Status    `json:"to_status"`
+	ChangedBy  string    `json:"changed_by"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type ListFilter struct {
+	UserID *uuid.UUID
+	Status Status
+	From   *time.Time
+	To     *time.Time
+	Page   int
+	Limit  int
+}
+
+// Normalize fills in the default page and limit and caps the limit at
+// MaxPageLimit.
+func (f *ListFilter) Normalize() {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.Limit < 1 {
+		f.Limit = DefaultPageLimit
+	}
+	if f.Limit > MaxPageLimit {
+		f.Limit = MaxPageLimit
+	}
+}
+
+type OrderResponse struct {
+	ID           string              `json:"id"`
+	UserID       string              `json:"user_id"`
+	Status       Status              `json:"status"`
+	TotalAmount  string              `json:"total_amount"`
+	Items        []OrderItemResponse `json:"items,omitempty"`
+	CancelledBy  string              `json:"cancelled_by,omitempty"`
+	CancelledAt  *time.Time          `json:"cancelled_at,omitempty"`
+	CancelReason string              `json:"cancel_reason,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+type OrderItemResponse struct {
+	ID       string               `json:"id"`
+	DishID   string               `json:"dish_id"`
+	Quantity int                  `json:"quantity"`
+	Price    string               `json:"price"`
+	SubTotal string               `json:"sub_total"`
+	Dish     *dishes.DishResponse `json:"dish,omitempty"`
+}
+
+type ListOrdersResponse struct {
+	Orders []OrderResponse `json:"orders"`
+	Page   int             `json:"page"`
+	Limit  int             `json:"limit"`
+	Total  int64           `json:"total"`
+}
+
+func NewOrderResponse(order *Order) OrderResponse {
+	response := OrderResponse{
+		ID:          order.ID.String(),
+		UserID:      order.UserID.String(),
+		Status:      order.Status,
+		TotalAmount: order.TotalAmount.String(),
+		CreatedAt:   order.CreatedAt,
+		UpdatedAt:   order.UpdatedAt,
+	}
+
+	if order.CancelledBy != nil {
+		response.CancelledBy = order.CancelledBy.String()
+		response.CancelledAt = order.CancelledAt
+		response.CancelReason = order.CancelReason
+	}
+
+	for _, item := range order.Items {
+		itemResponse := OrderItemResponse{
+			ID:       item.ID.String(),
+			DishID:   item.DishID.String(),
+			Quantity: item.Quantity,
+			Price:    item.Price.String(),
+			SubTotal: item.SubTotal.String(),
+		}
+
+		if item.Dish.ID != uuid.Nil {
+			dish := dishes.NewDishResponse(&item.Dish)
+			itemResponse.Dish = &dish
+		}
+
+		response.Items = append(response.Items, itemResponse)
+	}
+
+	return response
+}
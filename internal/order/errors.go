@@ -0,0 +1,45 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidItems    = errors.New("invalid order items")
+	ErrInvalidDishID   = errors.New("invalid dish id")
+	ErrDishNotFound    = errors.New("dish not found")
+	ErrDishUnavailable = errors.New("dish unavailable")
+	ErrOutOfStock      = errors.New("not enough stock")
+)
+
+// ItemError describes what is wrong with a single item of an order request.
+// Index is the position of the item in the request body.
+type ItemError struct {
+	Index  int    `json:"index"`
+	DishID string `json:"dish_id"`
+	Error  string `json:"error"`
+}
+
+// ItemsError is returned when one or more items of an order cannot be
+// accepted. Err is one of ErrInvalidDishID, ErrInvalidItems, ErrDishNotFound,
+// ErrDishUnavailable or ErrOutOfStock, so callers can use errors.Is to decide
+// how to respond.
+type ItemsError struct {
+	Err   error
+	Items []ItemError
+}
+
+func (e *ItemsError) Error() string {
+	details := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		details[i] = fmt.Sprintf("item %d: %s", item.Index, item.Error)
+	}
+
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(details, "; "))
+}
+
+func (e *ItemsError) Unwrap() error {
+	return e.Err
+}
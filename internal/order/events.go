@@ -0,0 +1,56 @@
+package order
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+)
+
+// Publisher delivers order events to interested parties such as the kitchen
+// display feed.
+type Publisher interface {
+	Publish(eventType string, data any) error
+}
+
+type StatusChangedEvent struct {
+	OrderID    string    `json:"order_id"`
+	FromStatus Status    `json:"from_status"`
+	ToStatus   Status    `json:"to_status"`
+	ChangedBy  string    `json:"changed_by"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+func newStatusChangedEvent(change *OrderStatusHistory) StatusChangedEvent {
+	changedAt := change.CreatedAt
+	if changedAt.IsZero() {
+		changedAt = time.Now()
+	}
+
+	return StatusChangedEvent{
+		OrderID:    change.OrderID.String(),
+		FromStatus: change.FromStatus,
+		ToStatus:   change.ToStatus,
+		ChangedBy:  change.ChangedBy.String(),
+		Reason:     change.Reason,
+		ChangedAt:  changedAt,
+	}
+}
+
+// publish sends an event after the change it describes has been committed.
+// Failing to notify listeners must not fail the request, so errors are only
+// logged.
+func (s *orderService) publish(eventType string, data any) {
+	if s.publisher == nil {
+		return
+	}
+
+	if err := s.publisher.Publish(eventType, data); err != nil {
+		logrus.WithError(err).WithField("event", eventType).Error("failed to publish order event")
+	}
+}
@@ -1,9 +1,16 @@
 package order
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+	"github.com/EduardoMark/gastro-api/internal/users"
 	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -26,7 +33,12 @@ func (h *OrderHandler) OrderRoutes(r chi.Router) {
 	r.Route("/orders", func(r chi.Router) {
 		r.Use(h.jwt.JWTAuth)
 
-		r.Post("/", h.Create)
+		r.Get("/", h.List)
+		r.With(middleware.RequirePermission(rbac.PermOrderCreate)).Post("/", h.Create)
+		r.Get("/{id}", h.GetOne)
+		r.With(middleware.RequirePermission(rbac.PermOrderStatusUpdate)).Patch("/{id}/status", h.UpdateStatus)
+		r.Post("/{id}/cancel", h.Cancel)
+		r.With(middleware.RequirePermission(rbac.PermOrderReadAll)).Get("/{id}/history", h.GetHistory)
 	})
 }
 
@@ -65,14 +77,431 @@ func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.s.Create(ctx, userID, body.Items); err != nil {
+	record, err := h.s.Create(ctx, userID, body.Items)
+	if err != nil {
+		var itemsErr *ItemsError
+		if errors.As(err, &itemsErr) {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, ErrInvalidDishID) {
+				status = http.StatusBadRequest
+			}
+			if errors.Is(err, ErrDishNotFound) {
+				status = http.StatusNotFound
+			}
+			if errors.Is(err, ErrDishUnavailable) || errors.Is(err, ErrOutOfStock) {
+				status = http.StatusConflict
+			}
+
+			jsonutils.EncodeJson(w, status, ItemsErrorResponse{
+				Error: itemsErr.Err.Error(),
+				Items: itemsErr.Items,
+			})
+			return
+		}
+
+		if errors.Is(err, users.ErrEmailNotVerified) {
+			jsonutils.EncodeJson(w, http.StatusForbidden, map[string]string{
+				"error": "verify your email before placing orders",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusCreated, map[string]OrderResponse{
+		"order": NewOrderResponse(record),
+	})
+}
+
+func (h *OrderHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Update Order Status running...")
+
+	ctx := r.Context()
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user id not found",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[UpdateStatusRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.UpdateStatus(ctx, orderID, userID, body.Status); err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "order not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrStatusConflict) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidStatus) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": "invalid order status",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "order status updated with success",
+	})
+}
+
+func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Cancel Order running...")
+
+	ctx := r.Context()
+	role, ok := ctx.Value(middleware.CtxUserRole).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user role not found",
+		})
+		return
+	}
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user id not found",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	// The body is optional: clients cancelling their own order need not
+	// give a reason, staff are asked for one by the service.
+	body, err := jsonutils.DecodeJson[CancelRequest](r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.Cancel(ctx, orderID, userID, users.Role(role), body.Reason); err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "order not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrCancelReasonRequired) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrCancelNotAllowed) || errors.Is(err, ErrStatusConflict) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "order cancelled with success",
+	})
+}
+
+func (h *OrderHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	orderID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	records, err := h.s.GetHistory(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "order not found",
+			})
+			return
+		}
+
 		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
 			"error": "unexpected internal server error",
 		})
 		return
 	}
 
-	jsonutils.EncodeJson(w, http.StatusCreated, map[string]string{
-		"success": "order created with success",
+	response := make([]StatusHistoryResponse, len(records))
+	for i, record := range records {
+		response[i] = StatusHistoryResponse{
+			FromStatus: record.FromStatus,
+			ToStatus:   record.ToStatus,
+			ChangedBy:  record.ChangedBy.String(),
+			Reason:     record.Reason,
+			CreatedAt:  record.CreatedAt,
+		}
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string][]StatusHistoryResponse{
+		"history": response,
 	})
 }
+
+func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	role, ok := ctx.Value(middleware.CtxUserRole).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user role not found",
+		})
+		return
+	}
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user id not found",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	records, total, err := h.s.List(ctx, userID, users.Role(role), filter)
+	if err != nil {
+		if errors.Is(err, ErrInvalidStatus) {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid order status",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	response := ListOrdersResponse{
+		Orders: make([]OrderResponse, len(records)),
+		Page:   filter.Page,
+		Limit:  filter.Limit,
+		Total:  total,
+	}
+	for i := range records {
+		response.Orders[i] = NewOrderResponse(&records[i])
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, response)
+}
+
+func (h *OrderHandler) GetOne(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	role, ok := ctx.Value(middleware.CtxUserRole).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user role not found",
+		})
+		return
+	}
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "user id not found",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	orderID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	record, err := h.s.GetOne(ctx, orderID, userID, users.Role(role))
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "order not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]OrderResponse{
+		"order": NewOrderResponse(record),
+	})
+}
+
+// parseListFilter reads the pagination and filter query parameters of
+// GET /orders. Dates may be given as RFC 3339 timestamps or as plain
+// YYYY-MM-DD dates, in which case "to" includes the whole day.
+func parseListFilter(r *http.Request) (ListFilter, error) {
+	query := r.URL.Query()
+	filter := ListFilter{
+		Status: Status(query.Get("status")),
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid page parameter")
+		}
+		filter.Page = page
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid limit parameter")
+		}
+		filter.Limit = limit
+	}
+
+	if raw := query.Get("user_id"); raw != "" {
+		userID, err := uuid.Parse(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id parameter")
+		}
+		filter.UserID = &userID
+	}
+
+	if raw := query.Get("from"); raw != "" {
+		from, _, err := parseDate(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from parameter")
+		}
+		filter.From = &from
+	}
+
+	if raw := query.Get("to"); raw != "" {
+		to, dateOnly, err := parseDate(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to parameter")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	filter.Normalize()
+
+	return filter, nil
+}
+
+func parseDate(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return t, true, nil
+}
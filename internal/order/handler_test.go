@@ -0,0 +1,109 @@
+package order
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/users"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// MockService only implements Cancel; calling any other method panics.
+type MockService struct {
+	Service
+	cancelFunc func(ctx context.Context, orderID, userID uuid.UUID, role users.Role, reason string) error
+}
+
+func (m *MockService) Cancel(ctx context.Context, orderID, userID uuid.UUID, role users.Role, reason string) error {
+	if m.cancelFunc != nil {
+		return m.cancelFunc(ctx, orderID, userID, role, reason)
+	}
+	return nil
+}
+
+func cancelRequest(orderID, userID uuid.UUID, role users.Role, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/orders/"+orderID.String()+"/cancel", strings.NewReader(body))
+
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", orderID.String())
+
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+	ctx = context.WithValue(ctx, middleware.CtxUserId, userID.String())
+	ctx = context.WithValue(ctx, middleware.CtxUserRole, string(role))
+	return r.WithContext(ctx)
+}
+
+// TESTS
+
+func TestCancelHandler(t *testing.T) {
+	orderID := uuid.New()
+	userID := uuid.New()
+
+	t.Run("should cancel without a body", func(t *testing.T) {
+		var reason *string
+		h := NewOrderHandler(&MockService{
+			cancelFunc: func(ctx context.Context, id, uid uuid.UUID, role users.Role, r string) error {
+				reason = &r
+				return nil
+			},
+		}, middleware.JWTMiddleware{})
+
+		rec := httptest.NewRecorder()
+		h.Cancel(rec, cancelRequest(orderID, userID, users.RoleClient, ""))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if reason == nil || *reason != "" {
+			t.Errorf("expected the order cancelled without a reason, got %v", reason)
+		}
+	})
+
+	t.Run("should pass the reason on", func(t *testing.T) {
+		var reason string
+		h := NewOrderHandler(&MockService{
+			cancelFunc: func(ctx context.Context, id, uid uuid.UUID, role users.Role, r string) error {
+				reason = r
+				return nil
+			},
+		}, middleware.JWTMiddleware{})
+
+		rec := httptest.NewRecorder()
+		h.Cancel(rec, cancelRequest(orderID, userID, users.RoleManager, `{"reason": "out of stock"}`))
+
+		if rec.Code != http.StatusOK || reason != "out of stock" {
+			t.Errorf("expected 200 with the reason, got %d and %q", rec.Code, reason)
+		}
+	})
+
+	t.Run("should ask staff for a reason", func(t *testing.T) {
+		h := NewOrderHandler(&MockService{
+			cancelFunc: func(ctx context.Context, id, uid uuid.UUID, role users.Role, r string) error {
+				return ErrCancelReasonRequired
+			},
+		}, middleware.JWTMiddleware{})
+
+		rec := httptest.NewRecorder()
+		h.Cancel(rec, cancelRequest(orderID, userID, users.RoleManager, ""))
+
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", rec.Code)
+		}
+	})
+
+	t.Run("should reject a malformed body", func(t *testing.T) {
+		h := NewOrderHandler(&MockService{}, middleware.JWTMiddleware{})
+
+		rec := httptest.NewRecorder()
+		h.Cancel(rec, cancelRequest(orderID, userID, users.RoleClient, `{"reason":`))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rec.Code)
+		}
+	})
+}
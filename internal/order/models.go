@@ -13,17 +13,56 @@ type Status string
 const (
 	STATUS_NEW            Status = "new"
 	STATUS_IN_PREPARATION Status = "in preparation"
+	STATUS_READY          Status = "ready"
+	STATUS_DELIVERED      Status = "delivered"
 	STATUS_FINISHED       Status = "finished"
+	STATUS_CANCELLED      Status = "cancelled"
+	STATUS_REJECTED       Status = "rejected"
 )
 
+// transitions lists, for each status, the statuses an order may move to next.
+// Statuses without an entry are final.
+var transitions = map[Status][]Status{
+	STATUS_NEW:            {STATUS_IN_PREPARATION, STATUS_CANCELLED, STATUS_REJECTED},
+	STATUS_IN_PREPARATION: {STATUS_READY, STATUS_CANCELLED},
+	STATUS_READY:          {STATUS_DELIVERED, STATUS_FINISHED, STATUS_CANCELLED},
+	STATUS_DELIVERED:      {STATUS_FINISHED},
+}
+
+func (s Status) IsValid() bool {
+	switch s {
+	case STATUS_NEW, STATUS_IN_PREPARATION, STATUS_READY, STATUS_DELIVERED,
+		STATUS_FINISHED, STATUS_CANCELLED, STATUS_REJECTED:
+		return true
+	}
+	return false
+}
+
+func (s Status) IsFinal() bool {
+	return s.IsValid() && len(transitions[s]) == 0
+}
+
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Order struct {
-	ID          uuid.UUID       `json:"id" gorm:"type:uuid;default:gen_random_uuid()"`
-	UserID      uuid.UUID       `json:"user_id" gorm:"type:uuid;not null"`
-	Status      Status          `json:"status" gorm:"type:varchar(100);not null"`
-	TotalAmount decimal.Decimal `json:"total_amount" gorm:"type:numeric"`
-	Items       []OrderItem     `json:"items" gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	CreatedAt   time.Time       `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+	ID           uuid.UUID            `json:"id" gorm:"type:uuid;default:gen_random_uuid()"`
+	UserID       uuid.UUID            `json:"user_id" gorm:"type:uuid;not null"`
+	Status       Status               `json:"status" gorm:"type:varchar(100);not null"`
+	TotalAmount  decimal.Decimal      `json:"total_amount" gorm:"type:numeric"`
+	Items        []OrderItem          `json:"items" gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	History      []OrderStatusHistory `json:"history,omitempty" gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CancelledBy  *uuid.UUID           `json:"cancelled_by,omitempty" gorm:"type:uuid"`
+	CancelledAt  *time.Time           `json:"cancelled_at,omitempty"`
+	CancelReason string               `json:"cancel_reason,omitempty" gorm:"type:text"`
+	CreatedAt    time.Time            `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time            `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
 type OrderItem struct {
@@ -35,3 +74,15 @@ type OrderItem struct {
 	SubTotal decimal.Decimal `json:"sub_total" gorm:"type:numeric"`
 	Dish     dishes.Dish     `json:"dish" gorm:"foreignKey:DishID;references:ID"`
 }
+
+// OrderStatusHistory records a single status change of an order. The entry
+// written when the order is created has an empty FromStatus.
+type OrderStatusHistory struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;default:gen_random_uuid()"`
+	OrderID    uuid.UUID `json:"order_id" gorm:"type:uuid;not null;index"`
+	FromStatus Status    `json:"from_status" gorm:"type:varchar(100)"`
+	ToStatus   Status    `json:"to_status" gorm:"type:varchar(100);not null"`
+	ChangedBy  uuid.UUID `json:"changed_by" gorm:"type:uuid;not null"`
+	Reason     string    `json:"reason,omitempty" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -2,13 +2,25 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/EduardoMark/gastro-api/internal/dishes"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type Repository interface {
+	WithinTx(ctx context.Context, fn func(orders Repository, dishRepo dishes.Repository) error) error
 	Create(ctx context.Context, order *Order) error
+	GetOneByID(ctx context.Context, id uuid.UUID) (*Order, error)
+	GetDetails(ctx context.Context, id uuid.UUID) (*Order, error)
+	Query(ctx context.Context, filter ListFilter) ([]Order, int64, error)
+	UpdateStatus(ctx context.Context, change *OrderStatusHistory) error
+	Cancel(ctx context.Context, change *OrderStatusHistory) error
+	GetHistory(ctx context.Context, orderID uuid.UUID) ([]OrderStatusHistory, error)
+	HasOpenOrders(ctx context.Context, userID uuid.UUID) (bool, error)
 }
 
 type orderRepository struct {
@@ -21,6 +33,20 @@ func NewOrderRepository(db *gorm.DB) Repository {
 	}
 }
 
+var (
+	ErrOrderNotFound  = errors.New("order not found")
+	ErrStatusConflict = errors.New("order status was changed by another request")
+)
+
+// WithinTx runs fn inside a single database transaction. The repositories
+// handed to fn are bound to that transaction, and it is rolled back if fn
+// returns an error.
+func (r *orderRepository) WithinTx(ctx context.Context, fn func(orders Repository, dishRepo dishes.Repository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&orderRepository{db: tx}, dishes.NewDishRepository(tx))
+	})
+}
+
 func (r *orderRepository) Create(ctx context.Context, order *Order) error {
 	if err := r.db.WithContext(ctx).Create(order).Error; err != nil {
 		return fmt.Errorf("failed to create order: %v", err)
@@ -28,3 +54,154 @@ func (r *orderRepository) Create(ctx context.Context, order *Order) error {
 
 	return nil
 }
+
+func (r *orderRepository) GetOneByID(ctx context.Context, id uuid.UUID) (*Order, error) {
+	var order Order
+
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("GetOneByID - failed to get order: %v", err)
+	}
+
+	return &order, nil
+}
+
+// GetDetails loads the order together with its items and the dish each item
+// refers to.
+func (r *orderRepository) GetDetails(ctx context.Context, id uuid.UUID) (*Order, error) {
+	var order Order
+
+	err := r.db.WithContext(ctx).
+		Preload("Items").
+		Preload("Items.Dish", func(db *gorm.DB) *gorm.DB {
+			// Deleted dishes must still show up in past orders.
+			return db.Unscoped()
+		}).
+		Where("id = ?", id).
+		First(&order).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("GetDetails - failed to get order: %v", err)
+	}
+
+	return &order, nil
+}
+
+func (r *orderRepository) Query(ctx context.Context, filter ListFilter) ([]Order, int64, error) {
+	var orders []Order
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&Order{})
+
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("Query - failed to count orders: %v", err)
+	}
+
+	err := query.
+		Order("created_at DESC").
+		Limit(filter.Limit).
+		Offset((filter.Page - 1) * filter.Limit).
+		Find(&orders).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("Query - failed to find orders: %v", err)
+	}
+
+	return orders, total, nil
+}
+
+// UpdateStatus moves the order from change.FromStatus to change.ToStatus and
+// stores the change in the order history. The update only applies while the
+// order is still in change.FromStatus, so concurrent transitions cannot both
+// succeed.
+func (r *orderRepository) UpdateStatus(ctx context.Context, change *OrderStatusHistory) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return applyStatusChange(tx, change, map[string]any{
+			"status": change.ToStatus,
+		})
+	})
+}
+
+// Cancel works like UpdateStatus but also records who cancelled the order,
+// when and why.
+func (r *orderRepository) Cancel(ctx context.Context, change *OrderStatusHistory) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return applyStatusChange(tx, change, map[string]any{
+			"status":        change.ToStatus,
+			"cancelled_by":  change.ChangedBy,
+			"cancelled_at":  time.Now(),
+			"cancel_reason": change.Reason,
+		})
+	})
+}
+
+func applyStatusChange(tx *gorm.DB, change *OrderStatusHistory, columns map[string]any) error {
+	result := tx.Model(&Order{}).
+		Where("id = ? AND status = ?", change.OrderID, change.FromStatus).
+		Updates(columns)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update order status: %v", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrStatusConflict
+	}
+
+	if err := tx.Create(change).Error; err != nil {
+		return fmt.Errorf("failed to save status history: %v", err)
+	}
+
+	return nil
+}
+
+// HasOpenOrders reports whether the user has an order that did not reach a
+// final status yet.
+func (r *orderRepository) HasOpenOrders(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var count int64
+
+	err := r.db.WithContext(ctx).
+		Model(&Order{}).
+		Where("user_id = ? AND status NOT IN ?", userID, []Status{STATUS_FINISHED, STATUS_CANCELLED, STATUS_REJECTED}).
+		Count(&count).Error
+
+	if err != nil {
+		return false, fmt.Errorf("HasOpenOrders - failed to count orders: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *orderRepository) GetHistory(ctx context.Context, orderID uuid.UUID) ([]OrderStatusHistory, error) {
+	var history []OrderStatusHistory
+
+	err := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("created_at ASC").
+		Find(&history).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("GetHistory - failed to get order history: %v", err)
+	}
+
+	return history, nil
+}
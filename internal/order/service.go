@@ -2,64 +2,392 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/EduardoMark/gastro-api/internal/dishes"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+	"github.com/EduardoMark/gastro-api/internal/users"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type Service interface {
-	Create(ctx context.Context, userID uuid.UUID, items []createOrderItems) error
+	Create(ctx context.Context, userID uuid.UUID, items []createOrderItems) (*Order, error)
+	List(ctx context.Context, userID uuid.UUID, role users.Role, filter ListFilter) ([]Order, int64, error)
+	GetOne(ctx context.Context, orderID, userID uuid.UUID, role users.Role) (*Order, error)
+	UpdateStatus(ctx context.Context, orderID, changedBy uuid.UUID, status Status) error
+	Cancel(ctx context.Context, orderID, userID uuid.UUID, role users.Role, reason string) error
+	GetHistory(ctx context.Context, orderID uuid.UUID) ([]OrderStatusHistory, error)
+}
+
+// Policy decides whether a user may place orders at all, e.g. rejecting
+// clients who have not verified their email yet.
+type Policy interface {
+	CanPlaceOrder(ctx context.Context, userID uuid.UUID) error
 }
 
 type orderService struct {
 	repository Repository
-	dishRepo   dishes.Repository
+	publisher  Publisher
+	policy     Policy
 }
 
-func NewOrderService(repository Repository, dishRepo dishes.Repository) Service {
+func NewOrderService(repository Repository, publisher Publisher, policy Policy) Service {
 	return &orderService{
 		repository: repository,
-		dishRepo:   dishRepo,
+		publisher:  publisher,
+		policy:     policy,
 	}
 }
 
-func (s *orderService) Create(ctx context.Context, userID uuid.UUID, items []createOrderItems) error {
+var (
+	ErrInvalidStatus        = errors.New("invalid order status")
+	ErrInvalidTransition    = errors.New("invalid order status transition")
+	ErrCancelReasonRequired = errors.New("a reason is required to cancel this order")
+	ErrCancelNotAllowed     = errors.New("order can no longer be cancelled")
+)
+
+func (s *orderService) Create(ctx context.Context, userID uuid.UUID, items []createOrderItems) (*Order, error) {
+	if err := s.policy.CanPlaceOrder(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	dishIDs, err := parseItems(items)
+	if err != nil {
+		return nil, err
+	}
+
 	order := Order{
 		UserID:      userID,
 		Status:      STATUS_NEW,
-		Items:       []OrderItem{},
+		Items:       make([]OrderItem, 0, len(items)),
 		TotalAmount: decimal.NewFromInt(0),
+		History: []OrderStatusHistory{
+			{ToStatus: STATUS_NEW, ChangedBy: userID},
+		},
 	}
 
-	for _, i := range items {
-		dishID, err := uuid.Parse(i.DishID)
+	err = s.repository.WithinTx(ctx, func(orders Repository, dishRepo dishes.Repository) error {
+		records, err := dishRepo.GetManyByIDs(ctx, dishIDs)
 		if err != nil {
-			return fmt.Errorf("error on parse dish id to uuid type: %v", err)
+			return err
 		}
 
-		dish, err := s.dishRepo.GetOneByID(ctx, dishID)
-		if err != nil {
+		byID := make(map[uuid.UUID]*dishes.Dish, len(records))
+		for _, dish := range records {
+			byID[dish.ID] = dish
+		}
+
+		var missing, unavailable, outOfStock []ItemError
+		for i, dishID := range dishIDs {
+			dish, ok := byID[dishID]
+			if !ok {
+				missing = append(missing, ItemError{Index: i, DishID: items[i].DishID, Error: "dish not found"})
+				continue
+			}
+
+			if !dish.Available {
+				unavailable = append(unavailable, ItemError{Index: i, DishID: items[i].DishID, Error: "dish is currently unavailable"})
+				continue
+			}
+
+			if dish.Stock != nil && *dish.Stock < items[i].Quantity {
+				outOfStock = append(outOfStock, ItemError{
+					Index:  i,
+					DishID: items[i].DishID,
+					Error:  fmt.Sprintf("only %d left in stock", *dish.Stock),
+				})
+				continue
+			}
+
+			price := dish.Price
+			subTotal := price.Mul(decimal.NewFromInt(int64(items[i].Quantity)))
+
+			order.Items = append(order.Items, OrderItem{
+				DishID:   dishID,
+				Quantity: items[i].Quantity,
+				Price:    price,
+				SubTotal: subTotal,
+			})
+
+			order.TotalAmount = order.TotalAmount.Add(subTotal)
+		}
+
+		if len(missing) > 0 {
+			return &ItemsError{Err: ErrDishNotFound, Items: missing}
+		}
+
+		if len(unavailable) > 0 {
+			return &ItemsError{Err: ErrDishUnavailable, Items: unavailable}
+		}
+
+		if len(outOfStock) > 0 {
+			return &ItemsError{Err: ErrOutOfStock, Items: outOfStock}
+		}
+
+		if err := orders.Create(ctx, &order); err != nil {
 			return err
 		}
 
-		price := dish.Price
-		subTotal := price.Mul(decimal.NewFromInt(int64(i.Quantity)))
+		// The check above read a snapshot; the decrement itself is what
+		// guarantees concurrent orders cannot oversell.
+		for i, item := range order.Items {
+			if byID[item.DishID].Stock == nil {
+				continue
+			}
 
-		order.Items = append(order.Items, OrderItem{
-			DishID:   dishID,
-			Quantity: i.Quantity,
-			Price:    price,
-			SubTotal: subTotal,
-		})
+			err := dishRepo.AdjustStock(ctx, &dishes.StockMovement{
+				DishID:  item.DishID,
+				Delta:   -item.Quantity,
+				Reason:  dishes.StockReasonOrder,
+				OrderID: &order.ID,
+				UserID:  &userID,
+			})
+			if errors.Is(err, dishes.ErrInsufficientStock) {
+				outOfStock = append(outOfStock, ItemError{Index: i, DishID: item.DishID.String(), Error: "not enough stock"})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(outOfStock) > 0 {
+			return &ItemsError{Err: ErrOutOfStock, Items: outOfStock}
+		}
+
+		// Attached after saving so GORM does not try to upsert the dishes.
+		for i := range order.Items {
+			order.Items[i].Dish = *byID[order.Items[i].DishID]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(EventOrderCreated, NewOrderResponse(&order))
+
+	return &order, nil
+}
+
+// parseItems checks every item of an order request before anything is read
+// from the database and returns the dish ids in request order. Malformed ids
+// take precedence over other problems since they are a client bug rather
+// than a business rule violation.
+func parseItems(items []createOrderItems) ([]uuid.UUID, error) {
+	if len(items) == 0 {
+		return nil, &ItemsError{
+			Err:   ErrInvalidItems,
+			Items: []ItemError{{Index: 0, Error: "order must have at least 1 item"}},
+		}
+	}
+
+	dishIDs := make([]uuid.UUID, len(items))
+	seen := make(map[uuid.UUID]int, len(items))
+
+	var malformed, invalid []ItemError
+	for i, item := range items {
+		dishID, err := uuid.Parse(item.DishID)
+		if err != nil {
+			malformed = append(malformed, ItemError{Index: i, DishID: item.DishID, Error: "invalid dish id"})
+			continue
+		}
+		dishIDs[i] = dishID
+
+		if item.Quantity <= 0 {
+			invalid = append(invalid, ItemError{Index: i, DishID: item.DishID, Error: "quantity must be greater than 0"})
+		}
+
+		if first, ok := seen[dishID]; ok {
+			invalid = append(invalid, ItemError{
+				Index:  i,
+				DishID: item.DishID,
+				Error:  fmt.Sprintf("dish already ordered in item %d, merge the quantities instead", first),
+			})
+			continue
+		}
+		seen[dishID] = i
+	}
+
+	if len(malformed) > 0 {
+		return nil, &ItemsError{Err: ErrInvalidDishID, Items: malformed}
+	}
+
+	if len(invalid) > 0 {
+		return nil, &ItemsError{Err: ErrInvalidItems, Items: invalid}
+	}
+
+	return dishIDs, nil
+}
+
+// List returns a page of orders. Callers without order:read:all only ever see
+// their own orders, while the others see every order unless the filter
+// narrows it down to a single user.
+func (s *orderService) List(ctx context.Context, userID uuid.UUID, role users.Role, filter ListFilter) ([]Order, int64, error) {
+	if !role.Can(rbac.PermOrderReadAll) {
+		filter.UserID = &userID
+	}
+
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return nil, 0, ErrInvalidStatus
+	}
+
+	filter.Normalize()
+
+	orders, total, err := s.repository.Query(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
+}
+
+// GetOne returns the order with its items. Orders owned by someone else are
+// reported as not found to callers without order:read:all so their existence
+// is not leaked.
+func (s *orderService) GetOne(ctx context.Context, orderID, userID uuid.UUID, role users.Role) (*Order, error) {
+	order, err := s.repository.GetDetails(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !role.Can(rbac.PermOrderReadAll) && order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+func (s *orderService) UpdateStatus(ctx context.Context, orderID, changedBy uuid.UUID, status Status) error {
+	if !status.IsValid() {
+		return ErrInvalidStatus
+	}
+
+	order, err := s.repository.GetOneByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if status == STATUS_CANCELLED {
+		return fmt.Errorf("%w: orders must be cancelled through the cancel endpoint", ErrInvalidTransition)
+	}
+
+	if !order.Status.CanTransitionTo(status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, status)
+	}
+
+	change := OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ChangedBy:  changedBy,
+	}
+
+	if err := s.repository.UpdateStatus(ctx, &change); err != nil {
+		return err
+	}
+
+	s.publish(EventOrderStatusChanged, newStatusChangedEvent(&change))
+
+	return nil
+}
+
+// Cancel cancels an order on behalf of userID. Clients may only cancel their
+// own orders and only while they are still new; roles with order:cancel:any
+// may cancel any order that has not reached a final status, but must give a
+// reason.
+func (s *orderService) Cancel(ctx context.Context, orderID, userID uuid.UUID, role users.Role, reason string) error {
+	order, err := s.repository.GetOneByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if !role.Can(rbac.PermOrderCancelAny) {
+		if order.UserID != userID {
+			return ErrOrderNotFound
+		}
+
+		if order.Status != STATUS_NEW {
+			return ErrCancelNotAllowed
+		}
+	}
+
+	if role.Can(rbac.PermOrderCancelAny) && strings.TrimSpace(reason) == "" {
+		return ErrCancelReasonRequired
+	}
 
-		order.TotalAmount = order.TotalAmount.Add(subTotal)
+	if !order.Status.CanTransitionTo(STATUS_CANCELLED) {
+		return ErrCancelNotAllowed
 	}
 
-	if err := s.repository.Create(ctx, &order); err != nil {
+	change := OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   STATUS_CANCELLED,
+		ChangedBy:  userID,
+		Reason:     strings.TrimSpace(reason),
+	}
+
+	err = s.repository.WithinTx(ctx, func(orders Repository, dishRepo dishes.Repository) error {
+		if err := orders.Cancel(ctx, &change); err != nil {
+			return err
+		}
+
+		return restoreStock(ctx, orders, dishRepo, order.ID, userID)
+	})
+	if err != nil {
 		return err
 	}
 
+	s.publish(EventOrderStatusChanged, newStatusChangedEvent(&change))
+
 	return nil
 }
+
+// restoreStock puts the items of a cancelled order back into stock. Dishes
+// that stopped tracking stock or were deleted in the meantime are skipped.
+func restoreStock(ctx context.Context, orders Repository, dishRepo dishes.Repository, orderID, userID uuid.UUID) error {
+	details, err := orders.GetDetails(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range details.Items {
+		if item.Dish.Stock == nil {
+			continue
+		}
+
+		err := dishRepo.AdjustStock(ctx, &dishes.StockMovement{
+			DishID:  item.DishID,
+			Delta:   item.Quantity,
+			Reason:  dishes.StockReasonCancellation,
+			OrderID: &orderID,
+			UserID:  &userID,
+		})
+		if errors.Is(err, dishes.ErrStockNotTracked) || errors.Is(err, dishes.ErrDishNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *orderService) GetHistory(ctx context.Context, orderID uuid.UUID) ([]OrderStatusHistory, error) {
+	if _, err := s.repository.GetOneByID(ctx, orderID); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repository.GetHistory(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
@@ -0,0 +1,607 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EduardoMark/gastro-api/internal/dishes"
+	"github.com/EduardoMark/gastro-api/internal/users"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type MockRepository struct {
+	dishRepo         dishes.Repository
+	createFunc       func(ctx context.Context, order *Order) error
+	getOneByIDFunc   func(ctx context.Context, id uuid.UUID) (*Order, error)
+	getDetailsFunc   func(ctx context.Context, id uuid.UUID) (*Order, error)
+	queryFunc        func(ctx context.Context, filter ListFilter) ([]Order, int64, error)
+	updateStatusFunc func(ctx context.Context, change *OrderStatusHistory) error
+	cancelFunc       func(ctx context.Context, change *OrderStatusHistory) error
+	getHistoryFunc   func(ctx context.Context, orderID uuid.UUID) ([]OrderStatusHistory, error)
+	hasOpenFunc      func(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+// WithinTx runs fn right away, handing over the mock itself and dishRepo as
+// the transactional repositories.
+func (m *MockRepository) WithinTx(ctx context.Context, fn func(orders Repository, dishRepo dishes.Repository) error) error {
+	return fn(m, m.dishRepo)
+}
+
+func (m *MockRepository) Create(ctx context.Context, order *Order) error {
+	if m.createFunc != nil {
+		return m.createFunc(ctx, order)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetOneByID(ctx context.Context, id uuid.UUID) (*Order, error) {
+	if m.getOneByIDFunc != nil {
+		return m.getOneByIDFunc(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) GetDetails(ctx context.Context, id uuid.UUID) (*Order, error) {
+	if m.getDetailsFunc != nil {
+		return m.getDetailsFunc(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) Query(ctx context.Context, filter ListFilter) ([]Order, int64, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx, filter)
+	}
+	return nil, 0, nil
+}
+
+func (m *MockRepository) UpdateStatus(ctx context.Context, change *OrderStatusHistory) error {
+	if m.updateStatusFunc != nil {
+		return m.updateStatusFunc(ctx, change)
+	}
+	return nil
+}
+
+func (m *MockRepository) Cancel(ctx context.Context, change *OrderStatusHistory) error {
+	if m.cancelFunc != nil {
+		return m.cancelFunc(ctx, change)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetHistory(ctx context.Context, orderID uuid.UUID) ([]OrderStatusHistory, error) {
+	if m.getHistoryFunc != nil {
+		return m.getHistoryFunc(ctx, orderID)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) HasOpenOrders(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if m.hasOpenFunc != nil {
+		return m.hasOpenFunc(ctx, userID)
+	}
+	return false, nil
+}
+
+// MockDishRepository only implements the dish lookups used by the order
+// service; calling any other method panics.
+type MockDishRepository struct {
+	dishes.Repository
+	getManyByIDsFunc func(ctx context.Context, ids []uuid.UUID) ([]*dishes.Dish, error)
+	adjustStockFunc  func(ctx context.Context, movement *dishes.StockMovement) error
+}
+
+func (m *MockDishRepository) AdjustStock(ctx context.Context, movement *dishes.StockMovement) error {
+	if m.adjustStockFunc != nil {
+		return m.adjustStockFunc(ctx, movement)
+	}
+	return nil
+}
+
+func (m *MockDishRepository) GetManyByIDs(ctx context.Context, ids []uuid.UUID) ([]*dishes.Dish, error) {
+	if m.getManyByIDsFunc != nil {
+		return m.getManyByIDsFunc(ctx, ids)
+	}
+	return nil, nil
+}
+
+type MockPublisher struct {
+	events []string
+}
+
+func (m *MockPublisher) Publish(eventType string, data any) error {
+	m.events = append(m.events, eventType)
+	return nil
+}
+
+type MockPolicy struct {
+	err error
+}
+
+func (m *MockPolicy) CanPlaceOrder(ctx context.Context, userID uuid.UUID) error {
+	return m.err
+}
+
+// TESTS
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	pizza := &dishes.Dish{ID: uuid.New(), Name: "Pizza", Price: decimal.RequireFromString("42.50"), Available: true}
+	soda := &dishes.Dish{ID: uuid.New(), Name: "Soda", Price: decimal.RequireFromString("6.00"), Available: true}
+	pudding := &dishes.Dish{ID: uuid.New(), Name: "Pudding", Price: decimal.RequireFromString("9.90")}
+
+	dishRepo := &MockDishRepository{
+		getManyByIDsFunc: func(ctx context.Context, ids []uuid.UUID) ([]*dishes.Dish, error) {
+			var found []*dishes.Dish
+			for _, id := range ids {
+				for _, dish := range []*dishes.Dish{pizza, soda, pudding} {
+					if dish.ID == id {
+						found = append(found, dish)
+					}
+				}
+			}
+			return found, nil
+		},
+	}
+
+	t.Run("should create order with totals from a single dish lookup", func(t *testing.T) {
+		lookups := 0
+		mockRepo := &MockRepository{
+			dishRepo: &MockDishRepository{
+				getManyByIDsFunc: func(ctx context.Context, ids []uuid.UUID) ([]*dishes.Dish, error) {
+					lookups++
+					return dishRepo.getManyByIDsFunc(ctx, ids)
+				},
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		order, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: pizza.ID.String(), Quantity: 2},
+			{DishID: soda.ID.String(), Quantity: 3},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if lookups != 1 {
+			t.Errorf("expected 1 dish lookup, got: %d", lookups)
+		}
+
+		if !order.TotalAmount.Equal(decimal.RequireFromString("103.00")) {
+			t.Errorf("expected total 103.00, got: %s", order.TotalAmount)
+		}
+
+		if order.Status != STATUS_NEW || len(order.Items) != 2 {
+			t.Errorf("unexpected order: %+v", order)
+		}
+	})
+
+	t.Run("should reject malformed dish ids", func(t *testing.T) {
+		s := NewOrderService(&MockRepository{dishRepo: dishRepo}, nil, &MockPolicy{})
+
+		_, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: "not-a-uuid", Quantity: 1},
+			{DishID: pizza.ID.String(), Quantity: 0},
+		})
+		if !errors.Is(err, ErrInvalidDishID) {
+			t.Fatalf("expected ErrInvalidDishID, got: %v", err)
+		}
+
+		var itemsErr *ItemsError
+		if !errors.As(err, &itemsErr) || len(itemsErr.Items) != 1 || itemsErr.Items[0].Index != 0 {
+			t.Errorf("expected detail for item 0, got: %v", err)
+		}
+	})
+
+	t.Run("should reject non-positive and duplicated items", func(t *testing.T) {
+		s := NewOrderService(&MockRepository{dishRepo: dishRepo}, nil, &MockPolicy{})
+
+		_, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: pizza.ID.String(), Quantity: 1},
+			{DishID: soda.ID.String(), Quantity: -1},
+			{DishID: pizza.ID.String(), Quantity: 1},
+		})
+		if !errors.Is(err, ErrInvalidItems) {
+			t.Fatalf("expected ErrInvalidItems, got: %v", err)
+		}
+
+		var itemsErr *ItemsError
+		if !errors.As(err, &itemsErr) || len(itemsErr.Items) != 2 {
+			t.Errorf("expected 2 item errors, got: %v", err)
+		}
+	})
+
+	t.Run("should refuse unavailable dishes", func(t *testing.T) {
+		s := NewOrderService(&MockRepository{dishRepo: dishRepo}, nil, &MockPolicy{})
+
+		_, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: pizza.ID.String(), Quantity: 1},
+			{DishID: pudding.ID.String(), Quantity: 1},
+		})
+		if !errors.Is(err, ErrDishUnavailable) {
+			t.Errorf("expected ErrDishUnavailable, got: %v", err)
+		}
+	})
+
+	t.Run("should decrement tracked stock and refuse to oversell", func(t *testing.T) {
+		stock := 2
+		fries := &dishes.Dish{ID: uuid.New(), Price: decimal.RequireFromString("12.00"), Available: true, Stock: &stock}
+
+		var movements []*dishes.StockMovement
+		mockRepo := &MockRepository{
+			dishRepo: &MockDishRepository{
+				getManyByIDsFunc: func(ctx context.Context, ids []uuid.UUID) ([]*dishes.Dish, error) {
+					return []*dishes.Dish{fries, pizza}, nil
+				},
+				adjustStockFunc: func(ctx context.Context, movement *dishes.StockMovement) error {
+					movements = append(movements, movement)
+					return nil
+				},
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		_, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: fries.ID.String(), Quantity: 2},
+			{DishID: pizza.ID.String(), Quantity: 1},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if len(movements) != 1 || movements[0].DishID != fries.ID || movements[0].Delta != -2 {
+			t.Errorf("expected a single -2 movement for the tracked dish, got: %+v", movements)
+		}
+
+		_, err = s.Create(ctx, userID, []createOrderItems{
+			{DishID: fries.ID.String(), Quantity: 3},
+		})
+		if !errors.Is(err, ErrOutOfStock) {
+			t.Errorf("expected ErrOutOfStock, got: %v", err)
+		}
+	})
+
+	t.Run("should report every missing dish without saving", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			dishRepo: dishRepo,
+			createFunc: func(ctx context.Context, order *Order) error {
+				t.Error("expected order not to be saved")
+				return nil
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		_, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: pizza.ID.String(), Quantity: 1},
+			{DishID: uuid.NewString(), Quantity: 1},
+		})
+		if !errors.Is(err, ErrDishNotFound) {
+			t.Fatalf("expected ErrDishNotFound, got: %v", err)
+		}
+
+		var itemsErr *ItemsError
+		if !errors.As(err, &itemsErr) || len(itemsErr.Items) != 1 || itemsErr.Items[0].Index != 1 {
+			t.Errorf("expected detail for item 1, got: %v", err)
+		}
+	})
+
+	t.Run("should refuse orders the policy rejects", func(t *testing.T) {
+		s := NewOrderService(&MockRepository{dishRepo: dishRepo}, nil, &MockPolicy{err: users.ErrEmailNotVerified})
+
+		_, err := s.Create(ctx, userID, []createOrderItems{
+			{DishID: pizza.ID.String(), Quantity: 1},
+		})
+		if !errors.Is(err, users.ErrEmailNotVerified) {
+			t.Errorf("expected ErrEmailNotVerified, got: %v", err)
+		}
+	})
+}
+
+func TestUpdateStatus(t *testing.T) {
+	ctx := context.Background()
+	orderID := uuid.New()
+	staffID := uuid.New()
+
+	withStatus := func(status Status) func(ctx context.Context, id uuid.UUID) (*Order, error) {
+		return func(ctx context.Context, id uuid.UUID) (*Order, error) {
+			return &Order{ID: id, Status: status}, nil
+		}
+	}
+
+	t.Run("should move order to the next status and record history", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		mockRepo := &MockRepository{
+			getOneByIDFunc: withStatus(STATUS_NEW),
+			updateStatusFunc: func(ctx context.Context, change *OrderStatusHistory) error {
+				saved = change
+				return nil
+			},
+		}
+
+		publisher := &MockPublisher{}
+		s := NewOrderService(mockRepo, publisher, &MockPolicy{})
+
+		if err := s.UpdateStatus(ctx, orderID, staffID, STATUS_IN_PREPARATION); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if len(publisher.events) != 1 || publisher.events[0] != EventOrderStatusChanged {
+			t.Errorf("expected a status changed event, got: %v", publisher.events)
+		}
+
+		if saved == nil {
+			t.Fatal("expected status change to be saved")
+		}
+
+		if saved.OrderID != orderID || saved.FromStatus != STATUS_NEW ||
+			saved.ToStatus != STATUS_IN_PREPARATION || saved.ChangedBy != staffID {
+			t.Errorf("unexpected status change: %+v", saved)
+		}
+	})
+
+	t.Run("should reject illegal transitions", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getOneByIDFunc: withStatus(STATUS_NEW),
+			updateStatusFunc: func(ctx context.Context, change *OrderStatusHistory) error {
+				t.Error("expected repository not to be called")
+				return nil
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		err := s.UpdateStatus(ctx, orderID, staffID, STATUS_DELIVERED)
+		if !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("expected ErrInvalidTransition, got: %v", err)
+		}
+	})
+
+	t.Run("should not leave a final status", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getOneByIDFunc: withStatus(STATUS_FINISHED),
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		err := s.UpdateStatus(ctx, orderID, staffID, STATUS_NEW)
+		if !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("expected ErrInvalidTransition, got: %v", err)
+		}
+	})
+
+	t.Run("should return ErrInvalidStatus for unknown status", func(t *testing.T) {
+		s := NewOrderService(&MockRepository{}, nil, &MockPolicy{})
+
+		err := s.UpdateStatus(ctx, orderID, staffID, Status("burnt"))
+		if !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("expected ErrInvalidStatus, got: %v", err)
+		}
+	})
+
+	t.Run("should return ErrOrderNotFound when order does not exist", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getOneByIDFunc: func(ctx context.Context, id uuid.UUID) (*Order, error) {
+				return nil, ErrOrderNotFound
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		err := s.UpdateStatus(ctx, orderID, staffID, STATUS_READY)
+		if !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("expected ErrOrderNotFound, got: %v", err)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("should scope clients to their own orders", func(t *testing.T) {
+		var got ListFilter
+		mockRepo := &MockRepository{
+			queryFunc: func(ctx context.Context, filter ListFilter) ([]Order, int64, error) {
+				got = filter
+				return nil, 0, nil
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		other := uuid.New()
+		if _, _, err := s.List(ctx, userID, users.RoleClient, ListFilter{UserID: &other}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if got.UserID == nil || *got.UserID != userID {
+			t.Errorf("expected filter scoped to %s, got: %v", userID, got.UserID)
+		}
+
+		if got.Page != 1 || got.Limit != DefaultPageLimit {
+			t.Errorf("expected default pagination, got page %d limit %d", got.Page, got.Limit)
+		}
+	})
+
+	t.Run("should let staff list every order", func(t *testing.T) {
+		var got ListFilter
+		mockRepo := &MockRepository{
+			queryFunc: func(ctx context.Context, filter ListFilter) ([]Order, int64, error) {
+				got = filter
+				return nil, 0, nil
+			},
+		}
+
+		s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+		if _, _, err := s.List(ctx, userID, users.RoleAdmin, ListFilter{Limit: 1000}); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if got.UserID != nil {
+			t.Errorf("expected no user filter, got: %v", got.UserID)
+		}
+
+		if got.Limit != MaxPageLimit {
+			t.Errorf("expected limit capped at %d, got: %d", MaxPageLimit, got.Limit)
+		}
+	})
+}
+
+func TestGetOne(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+
+	mockRepo := &MockRepository{
+		getDetailsFunc: func(ctx context.Context, id uuid.UUID) (*Order, error) {
+			return &Order{ID: id, UserID: ownerID, Status: STATUS_NEW}, nil
+		},
+	}
+
+	s := NewOrderService(mockRepo, nil, &MockPolicy{})
+
+	t.Run("should return the order to its owner", func(t *testing.T) {
+		if _, err := s.GetOne(ctx, uuid.New(), ownerID, users.RoleClient); err != nil {
+			t.Errorf("expected no error, but got: %v", err)
+		}
+	})
+
+	t.Run("should hide orders of other clients", func(t *testing.T) {
+		_, err := s.GetOne(ctx, uuid.New(), uuid.New(), users.RoleClient)
+		if !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("expected ErrOrderNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("should return any order to admins", func(t *testing.T) {
+		if _, err := s.GetOne(ctx, uuid.New(), uuid.New(), users.RoleAdmin); err != nil {
+			t.Errorf("expected no error, but got: %v", err)
+		}
+	})
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	ownerID := uuid.New()
+	adminID := uuid.New()
+
+	newService := func(status Status, saved **OrderStatusHistory) Service {
+		return NewOrderService(&MockRepository{
+			getOneByIDFunc: func(ctx context.Context, id uuid.UUID) (*Order, error) {
+				return &Order{ID: id, UserID: ownerID, Status: status}, nil
+			},
+			getDetailsFunc: func(ctx context.Context, id uuid.UUID) (*Order, error) {
+				return &Order{ID: id, UserID: ownerID, Status: STATUS_CANCELLED}, nil
+			},
+			cancelFunc: func(ctx context.Context, change *OrderStatusHistory) error {
+				*saved = change
+				return nil
+			},
+		}, nil, &MockPolicy{})
+	}
+
+	t.Run("should let the owner cancel a new order", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		s := newService(STATUS_NEW, &saved)
+
+		if err := s.Cancel(ctx, uuid.New(), ownerID, users.RoleClient, ""); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if saved == nil || saved.ToStatus != STATUS_CANCELLED || saved.ChangedBy != ownerID {
+			t.Errorf("unexpected cancellation: %+v", saved)
+		}
+	})
+
+	t.Run("should not let the owner cancel once preparation started", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		s := newService(STATUS_IN_PREPARATION, &saved)
+
+		err := s.Cancel(ctx, uuid.New(), ownerID, users.RoleClient, "changed my mind")
+		if !errors.Is(err, ErrCancelNotAllowed) {
+			t.Errorf("expected ErrCancelNotAllowed, got: %v", err)
+		}
+	})
+
+	t.Run("should hide orders of other clients", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		s := newService(STATUS_NEW, &saved)
+
+		err := s.Cancel(ctx, uuid.New(), uuid.New(), users.RoleClient, "")
+		if !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("expected ErrOrderNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("should require a reason from admins", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		s := newService(STATUS_READY, &saved)
+
+		err := s.Cancel(ctx, uuid.New(), adminID, users.RoleAdmin, "  ")
+		if !errors.Is(err, ErrCancelReasonRequired) {
+			t.Errorf("expected ErrCancelReasonRequired, got: %v", err)
+		}
+	})
+
+	t.Run("should let admins cancel with a reason", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		s := newService(STATUS_READY, &saved)
+
+		if err := s.Cancel(ctx, uuid.New(), adminID, users.RoleAdmin, "customer left"); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if saved == nil || saved.Reason != "customer left" || saved.ChangedBy != adminID {
+			t.Errorf("unexpected cancellation: %+v", saved)
+		}
+	})
+
+	t.Run("should put tracked items back into stock", func(t *testing.T) {
+		stock := 0
+		dishID := uuid.New()
+
+		var restored *dishes.StockMovement
+		s := NewOrderService(&MockRepository{
+			getOneByIDFunc: func(ctx context.Context, id uuid.UUID) (*Order, error) {
+				return &Order{ID: id, UserID: ownerID, Status: STATUS_NEW}, nil
+			},
+			getDetailsFunc: func(ctx context.Context, id uuid.UUID) (*Order, error) {
+				return &Order{ID: id, Items: []OrderItem{
+					{DishID: dishID, Quantity: 3, Dish: dishes.Dish{ID: dishID, Stock: &stock}},
+				}}, nil
+			},
+			dishRepo: &MockDishRepository{
+				adjustStockFunc: func(ctx context.Context, movement *dishes.StockMovement) error {
+					restored = movement
+					return nil
+				},
+			},
+		}, nil, &MockPolicy{})
+
+		if err := s.Cancel(ctx, uuid.New(), ownerID, users.RoleClient, ""); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if restored == nil || restored.DishID != dishID || restored.Delta != 3 ||
+			restored.Reason != dishes.StockReasonCancellation {
+			t.Errorf("unexpected stock movement: %+v", restored)
+		}
+	})
+
+	t.Run("should not cancel a final order", func(t *testing.T) {
+		var saved *OrderStatusHistory
+		s := newService(STATUS_CANCELLED, &saved)
+
+		err := s.Cancel(ctx, uuid.New(), adminID, users.RoleAdmin, "again")
+		if !errors.Is(err, ErrCancelNotAllowed) {
+			t.Errorf("expected ErrCancelNotAllowed, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+// Package rbac holds the roles known to the API and the permissions each of
+// them grants. Routes declare the permissions they need through
+// middleware.RequirePermission, so adding a staff role only means adding it
+// to the matrix below.
+package rbac
+
+type Permission string
+
+const (
+	// Menu
+	PermDishReadAll      Permission = "dish:read:all"
+	PermDishWrite        Permission = "dish:write"
+	PermDishAvailability Permission = "dish:availability"
+	PermStockRead        Permission = "stock:read"
+	PermStockWrite       Permission = "stock:write"
+	PermCategoryWrite    Permission = "category:write"
+
+	// Orders
+	PermOrderCreate       Permission = "order:create"
+	PermOrderReadAll      Permission = "order:read:all"
+	PermOrderStatusUpdate Permission = "order:status:update"
+	PermOrderCancelAny    Permission = "order:cancel:any"
+	PermKitchenStream     Permission = "kitchen:stream"
+
+	// Administration
+	PermUserManage Permission = "user:manage"
+	PermReportRead Permission = "report:read"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleKitchen = "kitchen"
+	RoleWaiter  = "waiter"
+	RoleCashier = "cashier"
+	RoleClient  = "client"
+)
+
+var matrix = map[string][]Permission{
+	RoleAdmin: {
+		PermDishReadAll, PermDishWrite, PermDishAvailability, PermStockRead, PermStockWrite, PermCategoryWrite,
+		PermOrderCreate, PermOrderReadAll, PermOrderStatusUpdate, PermOrderCancelAny, PermKitchenStream,
+		PermUserManage, PermReportRead,
+	},
+	RoleManager: {
+		PermDishReadAll, PermDishWrite, PermDishAvailability, PermStockRead, PermStockWrite, PermCategoryWrite,
+		PermOrderCreate, PermOrderReadAll, PermOrderStatusUpdate, PermOrderCancelAny, PermKitchenStream,
+		PermReportRead,
+	},
+	RoleKitchen: {
+		PermDishReadAll, PermDishAvailability, PermStockRead,
+		PermOrderReadAll, PermOrderStatusUpdate, PermKitchenStream,
+	},
+	RoleWaiter: {
+		PermDishReadAll,
+		PermOrderCreate, PermOrderReadAll, PermOrderStatusUpdate,
+	},
+	RoleCashier: {
+		PermOrderReadAll, PermOrderStatusUpdate, PermOrderCancelAny,
+		PermReportRead,
+	},
+	RoleClient: {
+		PermOrderCreate,
+	},
+}
+
+// grants is the matrix indexed for constant-time lookups.
+var grants = func() map[string]map[Permission]bool {
+	grants := make(map[string]map[Permission]bool, len(matrix))
+	for role, perms := range matrix {
+		grants[role] = make(map[Permission]bool, len(perms))
+		for _, p := range perms {
+			grants[role][p] = true
+		}
+	}
+	return grants
+}()
+
+// IsRole reports whether role is part of the matrix.
+func IsRole(role string) bool {
+	_, ok := matrix[role]
+	return ok
+}
+
+// Can reports whether role grants every one of perms. Unknown roles grant
+// nothing.
+func Can(role string, perms ...Permission) bool {
+	granted, ok := grants[role]
+	if !ok {
+		return false
+	}
+
+	for _, p := range perms {
+		if !granted[p] {
+			return false
+		}
+	}
+
+	return true
+}
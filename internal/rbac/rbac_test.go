@@ -0,0 +1,43 @@
+package rbac
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	t.Run("admin is granted every permission", func(t *testing.T) {
+		for _, perms := range matrix {
+			if !Can(RoleAdmin, perms...) {
+				t.Errorf("expected admin to be granted %v", perms)
+			}
+		}
+	})
+
+	t.Run("client cannot write the menu", func(t *testing.T) {
+		if Can(RoleClient, PermDishWrite) {
+			t.Error("expected client not to be granted dish:write")
+		}
+
+		if !Can(RoleClient, PermOrderCreate) {
+			t.Error("expected client to be granted order:create")
+		}
+	})
+
+	t.Run("all permissions must be granted", func(t *testing.T) {
+		if Can(RoleKitchen, PermOrderStatusUpdate, PermDishWrite) {
+			t.Error("expected kitchen not to be granted dish:write")
+		}
+
+		if !Can(RoleKitchen, PermOrderStatusUpdate, PermKitchenStream) {
+			t.Error("expected kitchen to be granted status updates and the stream")
+		}
+	})
+
+	t.Run("unknown roles are granted nothing", func(t *testing.T) {
+		if Can("root", PermOrderCreate) {
+			t.Error("expected unknown role to be denied")
+		}
+
+		if IsRole("root") {
+			t.Error("expected root not to be a role")
+		}
+	})
+}
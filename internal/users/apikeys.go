@@ -0,0 +1,185 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// apiKeyTouchInterval limits how often the last use of a key is written, so
+// busy integrations do not update the row on every request.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidScope   = errors.New("invalid api key scope")
+	ErrInvalidExpiry  = errors.New("api key expiry must be in the future")
+)
+
+// APIKey lets an integration, such as a POS terminal, call the API without
+// logging in. The key acts as its owner, limited to its scopes: scopes decide
+// which routes the key may call, while what those routes return follows the
+// owner's role. Routes that do not require a permission, such as the account
+// and password routes, never accept a key. Only the SHA-256 hash of the key
+// is stored; Prefix is the public start of the key, used to tell keys apart.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null"`
+	Prefix     string     `json:"prefix" gorm:"type:varchar(16);not null;uniqueIndex"`
+	KeyHash    string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	User       *User      `json:"-" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Scopes     Scopes     `json:"scopes" gorm:"type:jsonb;not null"`
+	CreatedBy  uuid.UUID  `json:"created_by" gorm:"type:uuid;not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Scopes are the permissions of an API key, stored as a JSON array.
+type Scopes []rbac.Permission
+
+func (s Scopes) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Scopes) Scan(value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		*s = nil
+		return nil
+	}
+	return fmt.Errorf("unsupported scopes type %T", value)
+}
+
+var apiKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newAPIKey returns a key formatted as "gst_<prefix>_<secret>" with its
+// prefix and hash.
+func newAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 5)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %v", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %v", err)
+	}
+
+	prefix = middleware.APIKeyPrefix + strings.ToLower(apiKeyEncoding.EncodeToString(id))
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, auth.HashToken(key), nil
+}
+
+// CreateAPIKey issues a key owned by req.UserID, or by the admin creating it
+// when no owner is given. Scopes must be granted by the owner's role, and
+// managing users is never delegated to a key. The raw key is returned once
+// and cannot be retrieved afterwards.
+func (s *userService) CreateAPIKey(ctx context.Context, actorID uuid.UUID, req CreateAPIKeyRequest) (*APIKey, string, error) {
+	ownerID := actorID
+	if req.UserID != "" {
+		id, err := uuid.Parse(req.UserID)
+		if err != nil {
+			return nil, "", ErrUserNotFound
+		}
+		ownerID = id
+	}
+
+	owner, err := s.r.GetUserByID(ctx, ownerID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scopes := make(Scopes, 0, len(req.Scopes))
+	for _, raw := range req.Scopes {
+		scope := rbac.Permission(raw)
+		if scope == rbac.PermUserManage || !owner.Role.Can(scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, raw)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidExpiry
+	}
+
+	raw, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		UserID:    owner.ID,
+		Scopes:    scopes,
+		CreatedBy: actorID,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := s.r.CreateAPIKey(ctx, &key); err != nil {
+		return nil, "", err
+	}
+
+	return &key, raw, nil
+}
+
+func (s *userService) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return s.r.ListAPIKeys(ctx)
+}
+
+func (s *userService) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	return s.r.RevokeAPIKey(ctx, id)
+}
+
+// VerifyAPIKey resolves a key for middleware.JWTAuth and records its use.
+func (s *userService) VerifyAPIKey(ctx context.Context, raw string) (*middleware.APIKeyPrincipal, error) {
+	key, err := s.r.GetAPIKeyByHash(ctx, auth.HashToken(raw))
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !key.Active(now) || key.User == nil {
+		return nil, nil
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.r.TouchAPIKey(ctx, key.ID, now); err != nil {
+			logrus.WithError(err).Warn("failed to record api key use")
+		}
+	}
+
+	return &middleware.APIKeyPrincipal{
+		KeyID:  key.ID.String(),
+		UserID: key.UserID.String(),
+		Role:   string(key.User.Role),
+		Scopes: key.Scopes,
+	}, nil
+}
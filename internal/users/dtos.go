@@ -2,16 +2,18 @@ package users
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/EduardoMark/gastro-api/internal/validation"
 	"github.com/go-playground/validator/v10"
 )
 
+// SignupRequest is used by the public signup endpoint, which always creates
+// clients. Staff accounts are created by admins through CreateStaffRequest.
 type SignupRequest struct {
 	Name     string `json:"name" validate:"required,min=3,max=100"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8,max=100"`
-	Role     Role   `json:"role" validate:"required"`
 }
 
 func (r SignupRequest) Validate() error {
@@ -32,10 +34,6 @@ func (r SignupRequest) Validate() error {
 		}
 	}
 
-	if r.Role != RoleAdmin && r.Role != RoleClient {
-		return fmt.Errorf("field role must be a valid role (admin or client)")
-	}
-
 	return nil
 }
 
@@ -84,3 +82,396 @@ func (r ChangePasswordRequest) Validate() error {
 	}
 	return nil
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (r RefreshRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (r ForgotPasswordRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+			if err.Tag() == "email" {
+				return fmt.Errorf("field %s must be a valid email address", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=100"`
+}
+
+func (r ResetPasswordRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+			if err.Tag() == "min" {
+				return fmt.Errorf("field %s must be at least %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+		}
+	}
+	return nil
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (r VerifyEmailRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+type LockoutResponse struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	Locked        bool       `json:"locked"`
+}
+
+func NewLockoutResponse(t *LoginThrottle, now time.Time) LockoutResponse {
+	return LockoutResponse{
+		Key:           t.Key,
+		Failures:      t.Failures,
+		LastFailureAt: t.LastFailureAt,
+		LockedUntil:   t.LockedUntil,
+		Locked:        t.Locked(now),
+	}
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+func (r TwoFactorCodeRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+func (r TwoFactorVerifyRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+func (r TwoFactorDisableRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+type TwoFactorChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// UpdateProfileRequest only changes the fields present in the body. Changing
+// one's own email requires the current password and verifying the new address
+// again. An empty phone clears it.
+type UpdateProfileRequest struct {
+	Name            *string      `json:"name" validate:"omitempty,min=3,max=100"`
+	Email           *string      `json:"email" validate:"omitempty,email"`
+	Phone           *string      `json:"phone" validate:"omitnil,e164|len=0"`
+	Preferences     *Preferences `json:"preferences"`
+	CurrentPassword string       `json:"current_password"`
+}
+
+func (r UpdateProfileRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "min" {
+				return fmt.Errorf("field %s must be at least %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "email" {
+				return fmt.Errorf("field %s must be a valid email address", err.Field())
+			}
+			if err.Tag() == "e164|len=0" {
+				return fmt.Errorf("field %s must be a phone number in E.164 format, e.g. +5511999999999", err.Field())
+			}
+			if err.Tag() == "bcp47_language_tag" {
+				return fmt.Errorf("field %s must be a language tag, e.g. pt-BR", err.Field())
+			}
+		}
+	}
+
+	return nil
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func (r DeleteAccountRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type QueryFilter struct {
+	Search string
+	Role   Role
+	Page   int
+	Limit  int
+}
+
+// Normalize fills in the default page and limit and caps the limit at
+// MaxPageLimit.
+func (f *QueryFilter) Normalize() {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.Limit < 1 {
+		f.Limit = DefaultPageLimit
+	}
+	if f.Limit > MaxPageLimit {
+		f.Limit = MaxPageLimit
+	}
+}
+
+type UserResponse struct {
+	ID               string      `json:"id"`
+	Name             string      `json:"name"`
+	Email            string      `json:"email"`
+	Phone            string      `json:"phone"`
+	Role             Role        `json:"role"`
+	Preferences      Preferences `json:"preferences"`
+	EmailVerified    bool        `json:"email_verified"`
+	TwoFactorEnabled bool        `json:"two_factor_enabled"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
+
+func NewUserResponse(user *User) UserResponse {
+	return UserResponse{
+		ID:               user.ID.String(),
+		Name:             user.Name,
+		Email:            user.Email,
+		Phone:            user.Phone,
+		Role:             user.Role,
+		Preferences:      user.Preferences,
+		EmailVerified:    user.EmailVerified(),
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+}
+
+type ListUsersResponse struct {
+	Users []UserResponse `json:"users"`
+	Page  int            `json:"page"`
+	Limit int            `json:"limit"`
+	Total int64          `json:"total"`
+}
+
+// CreateAPIKeyRequest creates a key acting as UserID, or as the caller when
+// UserID is empty. ExpiresAt is optional; keys without it never expire.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,min=3,max=100"`
+	UserID    string     `json:"user_id" validate:"omitempty,uuid"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r CreateAPIKeyRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+			if err.Tag() == "min" && err.Field() == "Scopes" {
+				return fmt.Errorf("field %s must have at least %s items", err.Field(), err.Param())
+			}
+			if err.Tag() == "min" {
+				return fmt.Errorf("field %s must be at least %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "uuid" {
+				return fmt.Errorf("field %s must be a valid uuid", err.Field())
+			}
+		}
+	}
+
+	return nil
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	UserID     string     `json:"user_id"`
+	Scopes     Scopes     `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func NewAPIKeyResponse(k *APIKey, now time.Time) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID.String(),
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		UserID:     k.UserID.String(),
+		Scopes:     k.Scopes,
+		CreatedBy:  k.CreatedBy.String(),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		Active:     k.Active(now),
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+// CreateAPIKeyResponse is the only response carrying the raw key.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type LogoutRequest struct {
+	All bool `json:"all"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type CreateStaffRequest struct {
+	Name     string `json:"name" validate:"required,min=3,max=100"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=100"`
+	Role     Role   `json:"role" validate:"required"`
+}
+
+func (r CreateStaffRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+			if err.Tag() == "min" {
+				return fmt.Errorf("field %s must be at least %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "max" {
+				return fmt.Errorf("field %s must be at most %s characters long", err.Field(), err.Param())
+			}
+			if err.Tag() == "email" {
+				return fmt.Errorf("field %s must be a valid email address", err.Field())
+			}
+		}
+	}
+
+	if !r.Role.IsValid() || r.Role == RoleClient {
+		return fmt.Errorf("field role must be a valid staff role")
+	}
+
+	return nil
+}
+
+type ChangeRoleRequest struct {
+	Role Role `json:"role" validate:"required"`
+}
+
+func (r ChangeRoleRequest) Validate() error {
+	if err := validation.Validate.Struct(r); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			if err.Tag() == "required" {
+				return fmt.Errorf("field %s is required", err.Field())
+			}
+		}
+	}
+
+	if !r.Role.IsValid() {
+		return fmt.Errorf("field role must be a valid role")
+	}
+
+	return nil
+}
@@ -2,10 +2,16 @@ package users
 
 import (
 	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/EduardoMark/gastro-api/internal/auth"
 	"github.com/EduardoMark/gastro-api/internal/middleware"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
 	"github.com/EduardoMark/gastro-api/pkg/jsonutils"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -33,6 +39,34 @@ func NerUserHandler(
 func (h *UserHandler) UserRoutes(r chi.Router) {
 	r.Post("/login", h.Login)
 
+	r.Route("/auth", func(r chi.Router) {
+		r.Post("/refresh", h.Refresh)
+		r.Post("/forgot-password", h.ForgotPassword)
+		r.Post("/reset-password", h.ResetPassword)
+		r.Post("/verify-email", h.VerifyEmail)
+		r.Post("/2fa/verify", h.VerifyTwoFactor)
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.jwtMiddleware.JWTAuth)
+
+			r.Post("/logout", h.Logout)
+			r.Post("/resend-verification", h.ResendVerification)
+			r.Post("/2fa/setup", h.SetupTwoFactor)
+			r.Post("/2fa/enable", h.EnableTwoFactor)
+			r.Post("/2fa/disable", h.DisableTwoFactor)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(rbac.PermUserManage))
+
+				r.Get("/lockouts", h.ListLockouts)
+				r.Delete("/lockouts/{key}", h.ClearLockout)
+				r.Get("/api-keys", h.ListAPIKeys)
+				r.Post("/api-keys", h.CreateAPIKey)
+				r.Delete("/api-keys/{id}", h.RevokeAPIKey)
+			})
+		})
+	})
+
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", h.Signup)
 
@@ -40,6 +74,20 @@ func (h *UserHandler) UserRoutes(r chi.Router) {
 			r.Use(h.jwtMiddleware.JWTAuth)
 
 			r.Put("/change-password", h.ChangePassword)
+			r.Get("/me", h.GetMe)
+			r.Patch("/me", h.UpdateMe)
+			r.Delete("/me", h.DeleteMe)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(rbac.PermUserManage))
+
+				r.Get("/", h.ListUsers)
+				r.Post("/staff", h.CreateStaff)
+				r.Get("/{id}", h.GetUser)
+				r.Patch("/{id}", h.UpdateUser)
+				r.Delete("/{id}", h.DeleteUser)
+				r.Patch("/{id}/role", h.ChangeRole)
+			})
 		})
 	})
 }
@@ -68,7 +116,7 @@ func (h *UserHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		body.Name,
 		body.Email,
 		body.Password,
-		body.Role,
+		RoleClient,
 	); err != nil {
 		if errors.Is(err, ErrEmailAlreadyExists) {
 			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
@@ -107,18 +155,21 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.s.Authenticate(ctx, body.Email, body.Password)
+	user, err := h.s.Authenticate(ctx, body.Email, body.Password, clientIP(r))
 	if err != nil {
-		if errors.Is(err, ErrUserNotFound) {
-			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
-				"error": "user not found",
+		var locked *LoginLockedError
+		if errors.As(err, &locked) {
+			retryAfter := int(time.Until(locked.Until).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			jsonutils.EncodeJson(w, http.StatusTooManyRequests, map[string]string{
+				"error": err.Error(),
 			})
 			return
 		}
 
 		if errors.Is(err, ErrInvalidCredentials) {
-			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
-				"error": "invalid credentials",
+			jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+				"error": "invalid email or password",
 			})
 			return
 		}
@@ -129,7 +180,24 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.authService.New(user.ID.String(), string(user.Role))
+	if user.TwoFactorEnabled() {
+		challenge, err := h.s.NewLoginChallenge(user)
+		if err != nil {
+			jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+				"error": "unexpected internal server error",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusOK, TwoFactorChallengeResponse{
+			MFARequired:    true,
+			ChallengeToken: challenge,
+			ExpiresIn:      int(LoginChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	session, refreshToken, err := h.s.StartSession(ctx, user.ID, false)
 	if err != nil {
 		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
 			"error": "unexpected internal server error",
@@ -137,17 +205,113 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
-		"token": token,
+	h.writeTokens(w, user, session, refreshToken)
+}
+
+// VerifyTwoFactor is the second step of a login with two-factor
+// authentication enabled. It exchanges the challenge token returned by Login
+// and a TOTP or recovery code for the session tokens.
+func (h *UserHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Verify Two Factor handler running...")
+	ctx := r.Context()
+
+	body, err := jsonutils.DecodeJson[TwoFactorVerifyRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.s.VerifyLoginChallenge(ctx, body.ChallengeToken, body.Code)
+	if err != nil {
+		var locked *LoginLockedError
+		if errors.As(err, &locked) {
+			retryAfter := int(time.Until(locked.Until).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			jsonutils.EncodeJson(w, http.StatusTooManyRequests, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidChallenge) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	session, refreshToken, err := h.s.StartSession(ctx, user.ID, true)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	h.writeTokens(w, user, session, refreshToken)
+}
+
+func (h *UserHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Setup Two Factor handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	secret, uri, err := h.s.SetupTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorEnabled) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: uri,
 	})
 }
 
-func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
-	logrus.Info("Change Password handler running...")
+func (h *UserHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Enable Two Factor handler running...")
 	ctx := r.Context()
 
-	userIDRaw := ctx.Value(middleware.CtxUserId)
-	userID, ok := userIDRaw.(string)
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
 	if !ok {
 		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
 			"error": "invalid user id in context",
@@ -155,7 +319,7 @@ func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uid, err := uuid.Parse(userID)
+	userID, err := uuid.Parse(userIDRaw)
 	if err != nil {
 		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
 			"error": "invalid user id type uuuid",
@@ -163,7 +327,7 @@ func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := jsonutils.DecodeJson[ChangePasswordRequest](r)
+	body, err := jsonutils.DecodeJson[TwoFactorCodeRequest](r)
 	if err != nil {
 		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
 			"error": "invalid body request",
@@ -178,17 +342,1104 @@ func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.s.ChangePassword(ctx, uid, body.NewPassword); err != nil {
-		if errors.Is(err, ErrSamePassword) {
-			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
-				"error": "new password cannot be the same as the old password",
+	codes, err := h.s.EnableTwoFactor(ctx, userID, body.Code)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorEnabled) || errors.Is(err, ErrTwoFactorNotSetUp) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
 			})
 			return
 		}
 
-		if errors.Is(err, ErrUserNotFound) {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Disable Two Factor handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[TwoFactorDisableRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.DisableTwoFactor(ctx, userID, body.Password, body.Code); err != nil {
+		if errors.Is(err, ErrTwoFactorNotEnabled) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "two-factor authentication disabled with success",
+	})
+}
+
+// clientIP returns the address of the peer. Deployments behind a reverse
+// proxy should install a middleware that sets RemoteAddr from the forwarded
+// headers they trust.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (h *UserHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	throttles, err := h.s.ListLockouts(ctx)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	now := time.Now()
+	response := make([]LockoutResponse, len(throttles))
+	for i := range throttles {
+		response[i] = NewLockoutResponse(&throttles[i], now)
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string][]LockoutResponse{
+		"lockouts": response,
+	})
+}
+
+// ClearLockout removes the failed attempts of a key such as
+// "email:someone@example.com" or "ip:203.0.113.7", unlocking it.
+func (h *UserHandler) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := url.PathUnescape(chi.URLParam(r, "key"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid lockout key",
+		})
+		return
+	}
+
+	if err := h.s.ClearLockout(ctx, key); err != nil {
+		if errors.Is(err, ErrLockoutNotFound) {
 			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
-				"error": "user not found",
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "lockout cleared with success",
+	})
+}
+
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, err := jsonutils.DecodeJson[RefreshRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, session, refreshToken, err := h.s.RefreshSession(ctx, body.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+				"error": "invalid refresh token",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	h.writeTokens(w, user, session, refreshToken)
+}
+
+// ForgotPassword always answers the same way so it cannot be used to find out
+// which emails have an account.
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Forgot Password handler running...")
+	ctx := r.Context()
+
+	body, err := jsonutils.DecodeJson[ForgotPasswordRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.RequestPasswordReset(ctx, body.Email); err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusAccepted, map[string]string{
+		"success": "if the email belongs to an account, a reset link was sent to it",
+	})
+}
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Reset Password handler running...")
+	ctx := r.Context()
+
+	body, err := jsonutils.DecodeJson[ResetPasswordRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.ResetPassword(ctx, body.Token, body.Password); err != nil {
+		if errors.Is(err, ErrInvalidResetToken) {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "password reset with success",
+	})
+}
+
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Verify Email handler running...")
+	ctx := r.Context()
+
+	body, err := jsonutils.DecodeJson[VerifyEmailRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.VerifyEmail(ctx, body.Token); err != nil {
+		if errors.Is(err, ErrInvalidVerification) {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "email verified with success",
+	})
+}
+
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Resend Verification handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	if err := h.s.ResendVerification(ctx, userID); err != nil {
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrVerificationThrottled) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(VerificationResendInterval.Seconds())))
+			jsonutils.EncodeJson(w, http.StatusTooManyRequests, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusAccepted, map[string]string{
+		"success": "verification email sent",
+	})
+}
+
+// Logout revokes the session of the access token used for the request, or
+// every session of the user when the body asks for it.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Logout handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	sessionIDRaw, ok := ctx.Value(middleware.CtxSessionID).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid session id in context",
+		})
+		return
+	}
+
+	sessionID, err := uuid.Parse(sessionIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid session id in context",
+		})
+		return
+	}
+
+	var body LogoutRequest
+	if r.ContentLength != 0 {
+		body, err = jsonutils.DecodeJson[LogoutRequest](r)
+		if err != nil {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid body request",
+			})
+			return
+		}
+	}
+
+	if body.All {
+		err = h.s.EndAllSessions(ctx, userID)
+	} else {
+		err = h.s.EndSession(ctx, userID, sessionID)
+	}
+
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) writeTokens(w http.ResponseWriter, user *User, session *Session, refreshToken string) {
+	token, err := h.authService.New(user.ID.String(), string(user.Role), session.ID.String(), session.MFA)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	})
+}
+
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Change Password handler running...")
+	ctx := r.Context()
+
+	userIDRaw := ctx.Value(middleware.CtxUserId)
+	userID, ok := userIDRaw.(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[ChangePasswordRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.ChangePassword(ctx, uid, body.NewPassword); err != nil {
+		if errors.Is(err, ErrSamePassword) {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "new password cannot be the same as the old password",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) CreateStaff(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Create Staff handler running...")
+	ctx := r.Context()
+
+	body, err := jsonutils.DecodeJson[CreateStaffRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.Create(ctx, body.Name, body.Email, body.Password, body.Role); err != nil {
+		if errors.Is(err, ErrEmailAlreadyExists) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": "email already exists",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidRole) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusCreated, map[string]string{
+		"success": "user created with success",
+	})
+}
+
+func (h *UserHandler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Change Role handler running...")
+	ctx := r.Context()
+
+	actorIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	actorID, err := uuid.Parse(actorIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[ChangeRoleRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.ChangeRole(ctx, actorID, userID, body.Role); err != nil {
+		if errors.Is(err, ErrInvalidRole) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrOwnRole) {
+			jsonutils.EncodeJson(w, http.StatusForbidden, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string]string{
+		"success": "user role updated with success",
+	})
+}
+
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Get Me handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	user, err := h.s.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, NewUserResponse(user))
+}
+
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Update Me handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[UpdateProfileRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.s.UpdateProfile(ctx, userID, body)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrCurrentPasswordRequired) || errors.Is(err, ErrInvalidCredentials) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrEmailAlreadyExists) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": "email already exists",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, NewUserResponse(user))
+}
+
+// DeleteMe deletes the caller's account after confirming the password. See
+// Service.DeleteAccount for what happens to the user's orders.
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Delete Me handler running...")
+	ctx := r.Context()
+
+	userIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[DeleteAccountRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.s.DeleteAccount(ctx, userID, body.Password); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidCredentials) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrOpenOrders) || errors.Is(err, ErrLastAdmin) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("List Users handler running...")
+	ctx := r.Context()
+
+	query := r.URL.Query()
+	filter := QueryFilter{
+		Search: strings.TrimSpace(query.Get("q")),
+		Role:   Role(query.Get("role")),
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid page parameter",
+			})
+			return
+		}
+		filter.Page = page
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid limit parameter",
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	filter.Normalize()
+
+	records, total, err := h.s.QueryUsers(ctx, filter)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRole) {
+			jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid role parameter",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	response := ListUsersResponse{
+		Users: make([]UserResponse, len(records)),
+		Page:  filter.Page,
+		Limit: filter.Limit,
+		Total: total,
+	}
+	for i := range records {
+		response.Users[i] = NewUserResponse(&records[i])
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, response)
+}
+
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Get User handler running...")
+	ctx := r.Context()
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	user, err := h.s.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, NewUserResponse(user))
+}
+
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Update User handler running...")
+	ctx := r.Context()
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[UpdateProfileRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.s.UpdateUser(ctx, userID, body)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrEmailAlreadyExists) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": "email already exists",
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, NewUserResponse(user))
+}
+
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Delete User handler running...")
+	ctx := r.Context()
+
+	actorIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	actorID, err := uuid.Parse(actorIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	if err := h.s.DeleteUser(ctx, actorID, userID); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrOwnAccount) {
+			jsonutils.EncodeJson(w, http.StatusForbidden, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrOpenOrders) || errors.Is(err, ErrLastAdmin) {
+			jsonutils.EncodeJson(w, http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("Create API Key handler running...")
+	ctx := r.Context()
+
+	actorIDRaw, ok := ctx.Value(middleware.CtxUserId).(string)
+	if !ok {
+		jsonutils.EncodeJson(w, http.StatusUnauthorized, map[string]string{
+			"error": "invalid user id in context",
+		})
+		return
+	}
+
+	actorID, err := uuid.Parse(actorIDRaw)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid user id type uuuid",
+		})
+		return
+	}
+
+	body, err := jsonutils.DecodeJson[CreateAPIKeyRequest](r)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	key, raw, err := h.s.CreateAPIKey(ctx, actorID, body)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidScope) || errors.Is(err, ErrInvalidExpiry) {
+			jsonutils.EncodeJson(w, http.StatusUnprocessableEntity, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	jsonutils.EncodeJson(w, http.StatusCreated, CreateAPIKeyResponse{
+		APIKeyResponse: NewAPIKeyResponse(key, time.Now()),
+		Key:            raw,
+	})
+}
+
+func (h *UserHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	keys, err := h.s.ListAPIKeys(ctx)
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusInternalServerError, map[string]string{
+			"error": "unexpected internal server error",
+		})
+		return
+	}
+
+	now := time.Now()
+	response := make([]APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = NewAPIKeyResponse(&keys[i], now)
+	}
+
+	jsonutils.EncodeJson(w, http.StatusOK, map[string][]APIKeyResponse{
+		"api_keys": response,
+	})
+}
+
+func (h *UserHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		jsonutils.EncodeJson(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid uuid type",
+		})
+		return
+	}
+
+	if err := h.s.RevokeAPIKey(ctx, id); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			jsonutils.EncodeJson(w, http.StatusNotFound, map[string]string{
+				"error": err.Error(),
 			})
 			return
 		}
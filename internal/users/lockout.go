@@ -0,0 +1,80 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per account and per client IP. Once a key goes
+// over its free attempts it is locked for a duration that doubles with every
+// further failure. Failures older than loginFailureWindow are forgotten.
+const (
+	loginFailureWindow  = time.Hour
+	accountFreeAttempts = 5
+	ipFreeAttempts      = 20
+	lockoutBase         = 30 * time.Second
+	lockoutMax          = time.Hour
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+	ErrLockoutNotFound = errors.New("lockout not found")
+)
+
+// LoginThrottle tracks failed logins for a key, either "email:<address>" or
+// "ip:<address>". Keys are tracked whether or not an account exists, so a
+// lockout does not reveal which emails are registered.
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"type:varchar(320);primaryKey"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at" gorm:"not null"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+// LoginLockedError is returned while a login is locked out.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+func accountKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// lockoutDuration returns how long a key with failures failed attempts is
+// locked, or zero while it is still within its free attempts.
+func lockoutDuration(failures, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	d := lockoutBase
+	for i := free; i < failures && d < lockoutMax; i++ {
+		d *= 2
+	}
+
+	return min(d, lockoutMax)
+}
+
+func freeAttempts(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		return ipFreeAttempts
+	}
+	return accountFreeAttempts
+}
@@ -1,15 +1,26 @@
 package users
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/EduardoMark/gastro-api/internal/rbac"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Role string
 
-var RoleAdmin Role = "admin"
-var RoleClient Role = "client"
+var (
+	RoleAdmin   Role = rbac.RoleAdmin
+	RoleManager Role = rbac.RoleManager
+	RoleKitchen Role = rbac.RoleKitchen
+	RoleWaiter  Role = rbac.RoleWaiter
+	RoleCashier Role = rbac.RoleCashier
+	RoleClient  Role = rbac.RoleClient
+)
 
 type User struct {
 	ID           uuid.UUID `json:"id" gorm:"default:gen_random_uuid();primaryKey"`
@@ -19,4 +30,115 @@ type User struct {
 	Role         Role      `json:"role" gorm:"type:varchar(50);not null"`
 	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	Phone       string      `json:"phone" gorm:"type:varchar(20);not null;default:''"`
+	Preferences Preferences `json:"preferences" gorm:"type:jsonb;not null;default:'{}'"`
+
+	// DeletedAt is set when the account is deleted. The row is kept, with its
+	// personal data erased, because orders keep referencing it.
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	VerificationSentAt *time.Time `json:"-"`
+
+	// TOTPSecret is set on enrollment and only used once TOTPEnabledAt is set.
+	// TOTPLastStep is the last accepted time step, so a code works once.
+	TOTPSecret    string     `json:"-" gorm:"type:varchar(64);not null;default:''"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep  *int64     `json:"-"`
+}
+
+// Preferences are the user's settings, stored as a JSON document.
+type Preferences struct {
+	Language           string `json:"language,omitempty" validate:"omitempty,bcp47_language_tag"`
+	OrderNotifications bool   `json:"order_notifications"`
+	MarketingEmails    bool   `json:"marketing_emails"`
+}
+
+func (p Preferences) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *Preferences) Scan(value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case nil:
+		*p = Preferences{}
+		return nil
+	}
+	return fmt.Errorf("unsupported preferences type %T", value)
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (r Role) IsValid() bool {
+	return rbac.IsRole(string(r))
+}
+
+// Can reports whether the role grants every one of perms.
+func (r Role) Can(perms ...rbac.Permission) bool {
+	return rbac.Can(string(r), perms...)
+}
+
+// Session is a login on one device. Access tokens carry the session id, so
+// revoking the session invalidates them before they expire. The session is
+// kept alive by rotating refresh tokens.
+type Session struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	User          *User      `json:"-" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason string     `json:"revoked_reason" gorm:"type:varchar(100)"`
+	MFA           bool       `json:"mfa" gorm:"not null;default:false"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is a single-use token of a session. Only the SHA-256 hash of
+// the token is stored. A token that is presented a second time means it was
+// stolen, and the whole session is revoked.
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	SessionID uuid.UUID  `json:"session_id" gorm:"type:uuid;not null;index"`
+	Session   *Session   `json:"-" gorm:"foreignKey:SessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// PasswordResetToken lets a user who forgot their password choose a new one.
+// Like refresh tokens, only the hash is stored and each token works once.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	User      *User      `json:"-" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the user
+// lost their authenticator. Only the hash is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	User      *User      `json:"-" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
 }
@@ -0,0 +1,139 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrOwnAccount = errors.New("use /users/me to delete your own account")
+	ErrOpenOrders = errors.New("the account has orders in progress, finish or cancel them first")
+
+	ErrCurrentPasswordRequired = errors.New("current password is required to change the email")
+)
+
+func (s *userService) GetUser(ctx context.Context, userID uuid.UUID) (*User, error) {
+	return s.r.GetUserByID(ctx, userID)
+}
+
+// UpdateProfile applies the fields present in req to the caller's own
+// account. Changing the email requires the current password, so a stolen
+// session cannot take the account over through a password reset. A new email
+// is stored as unverified and a verification link is sent to it, so clients
+// cannot order again until they confirm the new address.
+func (s *userService) UpdateProfile(ctx context.Context, userID uuid.UUID, req UpdateProfileRequest) (*User, error) {
+	user, err := s.r.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Email != nil && *req.Email != user.Email {
+		if req.CurrentPassword == "" {
+			return nil, ErrCurrentPasswordRequired
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+			return nil, ErrInvalidCredentials
+		}
+	}
+
+	return s.updateProfile(ctx, user, req)
+}
+
+// UpdateUser lets an admin apply req to another account, without its
+// password.
+func (s *userService) UpdateUser(ctx context.Context, userID uuid.UUID, req UpdateProfileRequest) (*User, error) {
+	user, err := s.r.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateProfile(ctx, user, req)
+}
+
+func (s *userService) updateProfile(ctx context.Context, user *User, req UpdateProfileRequest) (*User, error) {
+	if req.Name != nil {
+		user.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Phone != nil {
+		user.Phone = *req.Phone
+	}
+	if req.Preferences != nil {
+		user.Preferences = *req.Preferences
+	}
+
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if emailChanged {
+		now := time.Now()
+		user.Email = *req.Email
+		user.EmailVerifiedAt = nil
+		user.VerificationSentAt = &now
+	}
+
+	if err := s.r.UpdateProfile(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		s.sendVerification(ctx, user)
+	}
+
+	return user, nil
+}
+
+func (s *userService) QueryUsers(ctx context.Context, filter QueryFilter) ([]User, int64, error) {
+	filter.Normalize()
+
+	if filter.Role != "" && !filter.Role.IsValid() {
+		return nil, 0, ErrInvalidRole
+	}
+
+	return s.r.QueryUsers(ctx, filter)
+}
+
+// DeleteAccount deletes the user's own account after confirming the
+// password.
+func (s *userService) DeleteAccount(ctx context.Context, userID uuid.UUID, password string) error {
+	user, err := s.r.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	return s.deleteUser(ctx, user.ID)
+}
+
+// DeleteUser lets an admin delete another account. Admins delete their own
+// account through DeleteAccount, which asks for the password.
+func (s *userService) DeleteUser(ctx context.Context, actorID, userID uuid.UUID) error {
+	if actorID == userID {
+		return ErrOwnAccount
+	}
+
+	return s.deleteUser(ctx, userID)
+}
+
+// deleteUser is the account deletion policy: accounts with orders still in
+// progress cannot be deleted, so the kitchen never loses track of who an
+// order is for. Past orders are kept for sales history and keep pointing to
+// the account, whose personal data is erased.
+func (s *userService) deleteUser(ctx context.Context, userID uuid.UUID) error {
+	open, err := s.orders.HasOpenOrders(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if open {
+		return ErrOpenOrders
+	}
+
+	return s.r.DeleteUser(ctx, userID)
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
@@ -15,7 +18,35 @@ type Repository interface {
 	GetUserByID(ctx context.Context, id uuid.UUID) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	UpdatePassword(ctx context.Context, id uuid.UUID, newHash string) error
+	UpdateRole(ctx context.Context, id uuid.UUID, role Role) error
+	CreateFirstUser(ctx context.Context, user *User) (bool, error)
+	UpdateProfile(ctx context.Context, user *User) error
+	QueryUsers(ctx context.Context, filter QueryFilter) ([]User, int64, error)
 	DeleteUser(ctx context.Context, id uuid.UUID) error
+	CreateSession(ctx context.Context, session *Session, token *RefreshToken) error
+	GetSession(ctx context.Context, id uuid.UUID) (*Session, error)
+	RotateRefreshToken(ctx context.Context, tokenHash string, next *RefreshToken) (*Session, error)
+	RevokeSession(ctx context.Context, id, userID uuid.UUID, reason string) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID, reason string) error
+	CreatePasswordReset(ctx context.Context, token *PasswordResetToken) error
+	ResetPassword(ctx context.Context, tokenHash, newHash string) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) error
+	MarkVerificationSent(ctx context.Context, id uuid.UUID, minInterval time.Duration) (bool, error)
+	GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (*LoginThrottle, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ClearLoginThrottle(ctx context.Context, key string) error
+	ListLoginThrottles(ctx context.Context, window time.Duration) ([]LoginThrottle, error)
+	SetTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error
+	EnableTOTP(ctx context.Context, id uuid.UUID, step int64, codeHashes []string) error
+	DisableTOTP(ctx context.Context, id uuid.UUID) error
+	UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+	TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error
 }
 
 type userRepository struct {
@@ -29,8 +60,15 @@ func NewUserRepo(db *gorm.DB) Repository {
 }
 
 var (
-	ErrEmailAlreadyExists = errors.New("email already exists")
-	ErrUserNotFound       = errors.New("user not found")
+	ErrEmailAlreadyExists  = errors.New("email already exists")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token already used, session revoked")
+	ErrInvalidResetToken   = errors.New("invalid or expired reset token")
+	ErrInvalidVerification = errors.New("invalid or expired verification link")
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication already enabled")
+	ErrLastAdmin           = errors.New("the last admin account cannot be deleted")
 )
 
 func (r *userRepository) CreateUser(ctx context.Context, user *User) error {
@@ -77,14 +115,96 @@ func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*Use
 	return &user, nil
 }
 
+// UpdatePassword stores the new password hash and revokes every session of
+// the user in the same transaction, so stolen tokens stop working as soon as
+// the password changes.
 func (r *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, newHash string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ?", id).
+			Update("password_hash", newHash)
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to change password: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		return revokeUserSessions(tx, id, "password changed")
+	})
+}
+
+// UpdateRole changes the role of the user and revokes their sessions, since
+// the role is embedded in access tokens.
+func (r *userRepository) UpdateRole(ctx context.Context, id uuid.UUID, role Role) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ?", id).
+			Update("role", role)
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to change role: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		return revokeUserSessions(tx, id, "role changed")
+	})
+}
+
+// bootstrapLockKey identifies the advisory lock that serializes first user
+// creation across replicas starting at the same time.
+const bootstrapLockKey = 727001
+
+// CreateFirstUser creates user only when the users table is empty and reports
+// whether it did.
+func (r *userRepository) CreateFirstUser(ctx context.Context, user *User) (bool, error) {
+	created := false
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", bootstrapLockKey).Error; err != nil {
+			return fmt.Errorf("failed to lock users table: %w", err)
+		}
+
+		var count int64
+		if err := tx.Unscoped().Model(&User{}).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count users: %w", err)
+		}
+
+		if count > 0 {
+			return nil
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		created = true
+		return nil
+	})
+
+	return created, err
+}
+
+// UpdateProfile stores the profile fields of user. The verification columns
+// are written too, since changing the email resets them.
+func (r *userRepository) UpdateProfile(ctx context.Context, user *User) error {
 	result := r.db.WithContext(ctx).
 		Model(&User{}).
-		Where("id = ?", id).
-		Update("password_hash", newHash)
+		Where("id = ?", user.ID).
+		Select("name", "email", "phone", "preferences", "email_verified_at", "verification_sent_at").
+		Updates(user)
 
 	if result.Error != nil {
-		return fmt.Errorf("failed to change password: %w", result.Error)
+		var pgErr *pgconn.PgError
+		if errors.As(result.Error, &pgErr) && pgErr.Code == "23505" {
+			return ErrEmailAlreadyExists
+		}
+		return fmt.Errorf("failed to update profile: %w", result.Error)
 	}
 
 	if result.RowsAffected == 0 {
@@ -94,15 +214,562 @@ func (r *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, newHa
 	return nil
 }
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *userRepository) QueryUsers(ctx context.Context, filter QueryFilter) ([]User, int64, error) {
+	var users []User
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&User{})
+
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Search) + "%"
+		query = query.Where("name ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("QueryUsers - failed to count users: %v", err)
+	}
+
+	err := query.
+		Order("created_at DESC").
+		Order("id").
+		Limit(filter.Limit).
+		Offset((filter.Page - 1) * filter.Limit).
+		Find(&users).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("QueryUsers - failed to find users: %v", err)
+	}
+
+	return users, total, nil
+}
+
+// DeleteUser erases the personal data of the user and marks the account as
+// deleted. The row itself is kept so the user's orders still reference it.
+// Sessions are revoked and pending tokens and recovery codes are removed.
+// The last admin cannot be deleted, which is checked under the same lock as
+// the admin bootstrap.
 func (r *userRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&User{})
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", bootstrapLockKey).Error; err != nil {
+			return fmt.Errorf("failed to lock users table: %w", err)
+		}
+
+		var user User
+		if err := tx.First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		if user.Role == RoleAdmin {
+			var admins int64
+			if err := tx.Model(&User{}).Where("role = ?", RoleAdmin).Count(&admins).Error; err != nil {
+				return fmt.Errorf("failed to count admins: %w", err)
+			}
+
+			if admins <= 1 {
+				return ErrLastAdmin
+			}
+		}
+
+		err := tx.Model(&User{}).
+			Where("id = ?", id).
+			Updates(map[string]any{
+				"name":            "Deleted user",
+				"email":           fmt.Sprintf("deleted-%s@deleted.invalid", id),
+				"phone":           "",
+				"preferences":     Preferences{},
+				"password_hash":   "",
+				"totp_secret":     "",
+				"totp_enabled_at": nil,
+				"deleted_at":      time.Now(),
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&PasswordResetToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete reset tokens: %w", err)
+		}
+
+		return revokeUserSessions(tx, id, "account deleted")
+	})
+}
+
+func (r *userRepository) CreateSession(ctx context.Context, session *Session, token *RefreshToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+
+		token.SessionID = session.ID
+		if err := tx.Create(token).Error; err != nil {
+			return fmt.Errorf("failed to create refresh token: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *userRepository) GetSession(ctx context.Context, id uuid.UUID) (*Session, error) {
+	var session Session
+
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("GetSession - failed to find session: %v", err)
+	}
+
+	return &session, nil
+}
+
+// RotateRefreshToken marks the refresh token matching tokenHash as used and
+// stores next in its place, extending the session. Presenting a token that
+// was already used revokes the session and returns ErrRefreshTokenReused.
+func (r *userRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *RefreshToken) (*Session, error) {
+	var session Session
+	now := time.Now()
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current RefreshToken
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&current).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("failed to find refresh token: %w", err)
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", current.SessionID).
+			First(&session).Error
+		if err != nil {
+			return fmt.Errorf("failed to find session: %w", err)
+		}
+
+		if !session.Active(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		if current.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		if now.After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return fmt.Errorf("failed to use refresh token: %w", err)
+		}
+
+		next.SessionID = session.ID
+		if err := tx.Create(next).Error; err != nil {
+			return fmt.Errorf("failed to create refresh token: %w", err)
+		}
+
+		session.ExpiresAt = next.ExpiresAt
+		if err := tx.Model(&session).Update("expires_at", next.ExpiresAt).Error; err != nil {
+			return fmt.Errorf("failed to extend session: %w", err)
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// Revoked outside the rolled back transaction so it sticks.
+		if err := r.RevokeSession(ctx, session.ID, session.UserID, "refresh token reused"); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *userRepository) RevokeSession(ctx context.Context, id, userID uuid.UUID, reason string) error {
+	result := r.db.WithContext(ctx).
+		Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_reason": reason})
 
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete user: %w", result.Error)
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
 	}
 
 	if result.RowsAffected == 0 {
-		return ErrUserNotFound
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *userRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID, reason string) error {
+	return revokeUserSessions(r.db.WithContext(ctx), userID, reason)
+}
+
+func (r *userRepository) CreatePasswordReset(ctx context.Context, token *PasswordResetToken) error {
+	if err := r.db.WithContext(ctx).Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes the reset token and sets the new password hash. Any
+// other pending reset token of the user is consumed as well, and every
+// session is revoked.
+func (r *userRepository) ResetPassword(ctx context.Context, tokenHash, newHash string) error {
+	now := time.Now()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var token PasswordResetToken
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&token).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return fmt.Errorf("failed to find reset token: %w", err)
+		}
+
+		if token.UsedAt != nil || now.After(token.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		err = tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to use reset token: %w", err)
+		}
+
+		result := tx.Model(&User{}).
+			Where("id = ?", token.UserID).
+			Update("password_hash", newHash)
+		if result.Error != nil {
+			return fmt.Errorf("failed to reset password: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		return revokeUserSessions(tx, token.UserID, "password reset")
+	})
+}
+
+// MarkEmailVerified verifies the email of the user, as long as it is still
+// the email the verification link was sent to.
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) error {
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("id = ? AND email = ?", id, email).
+		Update("email_verified_at", gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()))
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to verify email: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidVerification
+	}
+
+	return nil
+}
+
+// MarkVerificationSent records that a verification email is being sent and
+// reports false, without recording anything, when the previous one was sent
+// less than minInterval ago.
+func (r *userRepository) MarkVerificationSent(ctx context.Context, id uuid.UUID, minInterval time.Duration) (bool, error) {
+	now := time.Now()
+
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("id = ? AND (verification_sent_at IS NULL OR verification_sent_at <= ?)", id, now.Add(-minInterval)).
+		Update("verification_sent_at", now)
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record verification email: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *userRepository) GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error) {
+	var throttles []LoginThrottle
+
+	if err := r.db.WithContext(ctx).Where("key IN ?", keys).Find(&throttles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get login throttles: %w", err)
+	}
+
+	return throttles, nil
+}
+
+// RecordLoginFailure counts a failed login for key, starting over when the
+// previous failure is older than window, and returns the updated counter.
+func (r *userRepository) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (*LoginThrottle, error) {
+	now := time.Now()
+	var throttle LoginThrottle
+
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at <= ? THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING key, failures, last_failure_at, locked_until`,
+		key, now, now.Add(-window),
+	).Scan(&throttle).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return &throttle, nil
+}
+
+func (r *userRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&LoginThrottle{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+func (r *userRepository) ClearLoginThrottle(ctx context.Context, key string) error {
+	result := r.db.WithContext(ctx).Where("key = ?", key).Delete(&LoginThrottle{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to clear login throttle: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrLockoutNotFound
+	}
+
+	return nil
+}
+
+// ListLoginThrottles returns the keys that are locked or failed within window,
+// most recent failure first.
+func (r *userRepository) ListLoginThrottles(ctx context.Context, window time.Duration) ([]LoginThrottle, error) {
+	now := time.Now()
+	throttles := []LoginThrottle{}
+
+	err := r.db.WithContext(ctx).
+		Where("locked_until > ? OR last_failure_at > ?", now, now.Add(-window)).
+		Order("last_failure_at DESC").
+		Find(&throttles).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login throttles: %w", err)
+	}
+
+	return throttles, nil
+}
+
+// SetTOTPSecret stores the secret of a pending enrollment. It fails with
+// ErrTwoFactorEnabled once two-factor authentication is enabled.
+func (r *userRepository) SetTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("id = ? AND totp_enabled_at IS NULL", id).
+		Update("totp_secret", secret)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to set totp secret: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// EnableTOTP turns two-factor authentication on, remembering step as used,
+// and replaces the recovery codes of the user.
+func (r *userRepository) EnableTOTP(ctx context.Context, id uuid.UUID, step int64, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ? AND totp_enabled_at IS NULL", id).
+			Updates(map[string]any{"totp_enabled_at": time.Now(), "totp_last_step": step})
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to enable totp: %w", result.Error)
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorEnabled
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		codes := make([]RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = RecoveryCode{UserID: id, CodeHash: hash}
+		}
+
+		if err := tx.Create(&codes).Error; err != nil {
+			return fmt.Errorf("failed to create recovery codes: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *userRepository) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).
+			Where("id = ?", id).
+			Updates(map[string]any{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": nil}).Error
+		if err != nil {
+			return fmt.Errorf("failed to disable totp: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// UseTOTPStep records step as the last accepted one and reports false when a
+// code of that step, or a later one, was already accepted.
+func (r *userRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)", id, step).
+		Update("totp_last_step", step)
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use totp step: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *userRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func revokeUserSessions(db *gorm.DB, userID uuid.UUID, reason string) error {
+	err := db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
+
+func (r *userRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash returns the key with its owner. The owner is left nil when
+// the account was deleted.
+func (r *userRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	var key APIKey
+
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("key_hash = ?", keyHash).
+		First(&key).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("GetAPIKeyByHash - failed to find api key: %v", err)
+	}
+
+	return &key, nil
+}
+
+func (r *userRepository) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+
+	err := r.db.WithContext(ctx).
+		Order("created_at DESC").
+		Find(&keys).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("ListAPIKeys - failed to find api keys: %v", err)
+	}
+
+	return keys, nil
+}
+
+func (r *userRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).
+		Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke api key: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *userRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", usedAt).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to record api key use: %w", err)
 	}
 
 	return nil
@@ -2,12 +2,18 @@ package users
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/EduardoMark/gastro-api/internal/mailer"
+	"github.com/EduardoMark/gastro-api/internal/rbac"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Deve implementar os mesmos metodos do repository real
@@ -17,6 +23,26 @@ type MockRepository struct {
 	getUserByEmailFunc func(ctx context.Context, email string) (*User, error)
 	updatePasswordFunc func(ctx context.Context, id uuid.UUID, newHash string) error
 	deleteUserFunc     func(ctx context.Context, id uuid.UUID) error
+	createSessionFunc  func(ctx context.Context, session *Session, token *RefreshToken) error
+	getSessionFunc     func(ctx context.Context, id uuid.UUID) (*Session, error)
+	rotateRefreshFunc  func(ctx context.Context, tokenHash string, next *RefreshToken) (*Session, error)
+	revokeSessionFunc  func(ctx context.Context, id, userID uuid.UUID, reason string) error
+	revokeSessionsFunc func(ctx context.Context, userID uuid.UUID, reason string) error
+	updateRoleFunc     func(ctx context.Context, id uuid.UUID, role Role) error
+	createFirstFunc    func(ctx context.Context, user *User) (bool, error)
+	createResetFunc    func(ctx context.Context, token *PasswordResetToken) error
+	resetPasswordFunc  func(ctx context.Context, tokenHash, newHash string) error
+	markVerifiedFunc   func(ctx context.Context, id uuid.UUID, email string) error
+	markSentFunc       func(ctx context.Context, id uuid.UUID, minInterval time.Duration) (bool, error)
+	updateProfileFunc  func(ctx context.Context, user *User) error
+	queryUsersFunc     func(ctx context.Context, filter QueryFilter) ([]User, int64, error)
+	throttles          map[string]*LoginThrottle
+	// totpUser and recoveryCodes hold the two-factor state written by the
+	// TOTP methods.
+	totpUser      *User
+	recoveryCodes map[string]bool
+	// apiKeys holds the keys written by CreateAPIKey, by hash.
+	apiKeys map[string]*APIKey
 }
 
 func (m *MockRepository) CreateUser(ctx context.Context, user *User) error {
@@ -47,6 +73,34 @@ func (m *MockRepository) UpdatePassword(ctx context.Context, id uuid.UUID, newHa
 	return nil
 }
 
+func (m *MockRepository) UpdateRole(ctx context.Context, id uuid.UUID, role Role) error {
+	if m.updateRoleFunc != nil {
+		return m.updateRoleFunc(ctx, id, role)
+	}
+	return nil
+}
+
+func (m *MockRepository) CreateFirstUser(ctx context.Context, user *User) (bool, error) {
+	if m.createFirstFunc != nil {
+		return m.createFirstFunc(ctx, user)
+	}
+	return false, nil
+}
+
+func (m *MockRepository) CreatePasswordReset(ctx context.Context, token *PasswordResetToken) error {
+	if m.createResetFunc != nil {
+		return m.createResetFunc(ctx, token)
+	}
+	return nil
+}
+
+func (m *MockRepository) ResetPassword(ctx context.Context, tokenHash, newHash string) error {
+	if m.resetPasswordFunc != nil {
+		return m.resetPasswordFunc(ctx, tokenHash, newHash)
+	}
+	return nil
+}
+
 func (m *MockRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	if m.deleteUserFunc != nil {
 		return m.deleteUserFunc(ctx, id)
@@ -54,6 +108,225 @@ func (m *MockRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+func (m *MockRepository) CreateSession(ctx context.Context, session *Session, token *RefreshToken) error {
+	if m.createSessionFunc != nil {
+		return m.createSessionFunc(ctx, session, token)
+	}
+	return nil
+}
+
+func (m *MockRepository) GetSession(ctx context.Context, id uuid.UUID) (*Session, error) {
+	if m.getSessionFunc != nil {
+		return m.getSessionFunc(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *RefreshToken) (*Session, error) {
+	if m.rotateRefreshFunc != nil {
+		return m.rotateRefreshFunc(ctx, tokenHash, next)
+	}
+	return nil, nil
+}
+
+func (m *MockRepository) RevokeSession(ctx context.Context, id, userID uuid.UUID, reason string) error {
+	if m.revokeSessionFunc != nil {
+		return m.revokeSessionFunc(ctx, id, userID, reason)
+	}
+	return nil
+}
+
+func (m *MockRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID, reason string) error {
+	if m.revokeSessionsFunc != nil {
+		return m.revokeSessionsFunc(ctx, userID, reason)
+	}
+	return nil
+}
+
+func (m *MockRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) error {
+	if m.markVerifiedFunc != nil {
+		return m.markVerifiedFunc(ctx, id, email)
+	}
+	return nil
+}
+
+func (m *MockRepository) MarkVerificationSent(ctx context.Context, id uuid.UUID, minInterval time.Duration) (bool, error) {
+	if m.markSentFunc != nil {
+		return m.markSentFunc(ctx, id, minInterval)
+	}
+	return true, nil
+}
+
+func (m *MockRepository) GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error) {
+	var found []LoginThrottle
+	for _, key := range keys {
+		if t, ok := m.throttles[key]; ok {
+			found = append(found, *t)
+		}
+	}
+	return found, nil
+}
+
+func (m *MockRepository) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (*LoginThrottle, error) {
+	if m.throttles == nil {
+		m.throttles = map[string]*LoginThrottle{}
+	}
+	t, ok := m.throttles[key]
+	if !ok {
+		t = &LoginThrottle{Key: key}
+		m.throttles[key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = time.Now()
+	snapshot := *t
+	return &snapshot, nil
+}
+
+func (m *MockRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	m.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (m *MockRepository) ClearLoginThrottle(ctx context.Context, key string) error {
+	if _, ok := m.throttles[key]; !ok {
+		return ErrLockoutNotFound
+	}
+	delete(m.throttles, key)
+	return nil
+}
+
+func (m *MockRepository) ListLoginThrottles(ctx context.Context, window time.Duration) ([]LoginThrottle, error) {
+	var found []LoginThrottle
+	for _, t := range m.throttles {
+		found = append(found, *t)
+	}
+	return found, nil
+}
+
+func (m *MockRepository) SetTOTPSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	if m.totpUser.TwoFactorEnabled() {
+		return ErrTwoFactorEnabled
+	}
+	m.totpUser.TOTPSecret = secret
+	return nil
+}
+
+func (m *MockRepository) EnableTOTP(ctx context.Context, id uuid.UUID, step int64, codeHashes []string) error {
+	now := time.Now()
+	m.totpUser.TOTPEnabledAt = &now
+	m.totpUser.TOTPLastStep = &step
+	m.recoveryCodes = map[string]bool{}
+	for _, hash := range codeHashes {
+		m.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+func (m *MockRepository) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	m.totpUser.TOTPSecret = ""
+	m.totpUser.TOTPEnabledAt = nil
+	m.recoveryCodes = nil
+	return nil
+}
+
+func (m *MockRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) (bool, error) {
+	if last := m.totpUser.TOTPLastStep; last != nil && step <= *last {
+		return false, nil
+	}
+	m.totpUser.TOTPLastStep = &step
+	return true, nil
+}
+
+func (m *MockRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	if !m.recoveryCodes[codeHash] {
+		return false, nil
+	}
+	delete(m.recoveryCodes, codeHash)
+	return true, nil
+}
+
+func (m *MockRepository) UpdateProfile(ctx context.Context, user *User) error {
+	if m.updateProfileFunc != nil {
+		return m.updateProfileFunc(ctx, user)
+	}
+	return nil
+}
+
+func (m *MockRepository) QueryUsers(ctx context.Context, filter QueryFilter) ([]User, int64, error) {
+	if m.queryUsersFunc != nil {
+		return m.queryUsersFunc(ctx, filter)
+	}
+	return nil, 0, nil
+}
+
+func (m *MockRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if m.apiKeys == nil {
+		m.apiKeys = map[string]*APIKey{}
+	}
+	key.ID = uuid.New()
+	m.apiKeys[key.KeyHash] = key
+	return nil
+}
+
+func (m *MockRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	key, ok := m.apiKeys[keyHash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	snapshot := *key
+	if m.getUserByIDFunc != nil {
+		snapshot.User, _ = m.getUserByIDFunc(ctx, key.UserID)
+	}
+	return &snapshot, nil
+}
+
+func (m *MockRepository) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	for _, key := range m.apiKeys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (m *MockRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	for _, key := range m.apiKeys {
+		if key.ID == id && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (m *MockRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	for _, key := range m.apiKeys {
+		if key.ID == id {
+			key.LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+var testSigner = auth.NewSigner([]byte("test-key"))
+
+type MockMailer struct {
+	sent []mailer.Message
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+type MockOrders struct {
+	open bool
+}
+
+func (m *MockOrders) HasOpenOrders(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return m.open, nil
+}
+
 // TESTS
 
 func TestCreate(t *testing.T) {
@@ -67,7 +340,7 @@ func TestCreate(t *testing.T) {
 			},
 		}
 
-		s := NewUserService(mockRepo)
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
 
 		err := s.Create(ctx, "Eduardo", "eduardo@email.com", "12345678", RoleAdmin)
 		if err != nil {
@@ -82,7 +355,7 @@ func TestCreate(t *testing.T) {
 			},
 		}
 
-		s := NewUserService(mockRepo)
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
 
 		err := s.Create(ctx, "Eduardo", "eduardo@email.com", "12345678", RoleClient)
 		if !errors.Is(err, ErrEmailAlreadyExists) {
@@ -97,7 +370,7 @@ func TestCreate(t *testing.T) {
 			},
 		}
 
-		s := NewUserService(mockRepo)
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
 
 		err := s.Create(ctx, "Eduardo", "eduardo@email.com", "12345678", RoleClient)
 		if err == nil {
@@ -109,6 +382,114 @@ func TestCreate(t *testing.T) {
 			t.Errorf("expected error to contain %q, got: %v", expectedMsg, err)
 		}
 	})
+	t.Run("should return ErrInvalidRole for unknown role", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			createUserFunc: func(ctx context.Context, user *User) error {
+				t.Fatal("repository should not be called")
+				return nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		err := s.Create(ctx, "Eduardo", "eduardo@email.com", "12345678", Role("root"))
+		if !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("expected ErrInvalidRole, got: %v", err)
+		}
+	})
+}
+
+func TestChangeRole(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should update the role of another user", func(t *testing.T) {
+		userID := uuid.New()
+		var gotRole Role
+
+		mockRepo := &MockRepository{
+			updateRoleFunc: func(ctx context.Context, id uuid.UUID, role Role) error {
+				if id != userID {
+					t.Errorf("expected id %s, got %s", userID, id)
+				}
+				gotRole = role
+				return nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		if err := s.ChangeRole(ctx, uuid.New(), userID, RoleAdmin); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if gotRole != RoleAdmin {
+			t.Errorf("expected role %s, got %s", RoleAdmin, gotRole)
+		}
+	})
+
+	t.Run("should not allow changing own role", func(t *testing.T) {
+		id := uuid.New()
+		s := NewUserService(&MockRepository{}, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		err := s.ChangeRole(ctx, id, id, RoleClient)
+		if !errors.Is(err, ErrOwnRole) {
+			t.Errorf("expected ErrOwnRole, got: %v", err)
+		}
+	})
+
+	t.Run("should reject invalid role", func(t *testing.T) {
+		s := NewUserService(&MockRepository{}, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		err := s.ChangeRole(ctx, uuid.New(), uuid.New(), Role(""))
+		if !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("expected ErrInvalidRole, got: %v", err)
+		}
+	})
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should create an admin when no user exists", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			createFirstFunc: func(ctx context.Context, user *User) (bool, error) {
+				if user.Role != RoleAdmin {
+					t.Errorf("expected role admin, got %s", user.Role)
+				}
+				return true, nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		created, err := s.BootstrapAdmin(ctx, "Admin", "admin@email.com", "12345678")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !created {
+			t.Error("expected admin to be created")
+		}
+	})
+
+	t.Run("should be a no-op when users exist", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			createFirstFunc: func(ctx context.Context, user *User) (bool, error) {
+				return false, nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		created, err := s.BootstrapAdmin(ctx, "Admin", "admin@email.com", "12345678")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if created {
+			t.Error("expected admin not to be created")
+		}
+	})
 }
 
 func TestGetUserByEmail(t *testing.T) {
@@ -126,7 +507,7 @@ func TestGetUserByEmail(t *testing.T) {
 			},
 		}
 
-		s := NewUserService(mockRepo)
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
 
 		user, err := s.GetUserByEmail(ctx, "eduardo@email.com")
 		if err != nil {
@@ -138,3 +519,893 @@ func TestGetUserByEmail(t *testing.T) {
 		}
 	})
 }
+
+func TestStartSession(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should store only the hash of the refresh token", func(t *testing.T) {
+		var stored *RefreshToken
+		mockRepo := &MockRepository{
+			createSessionFunc: func(ctx context.Context, session *Session, token *RefreshToken) error {
+				stored = token
+				return nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		_, raw, err := s.StartSession(ctx, uuid.New(), false)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if stored == nil || stored.TokenHash == raw || stored.TokenHash != auth.HashToken(raw) {
+			t.Errorf("expected hashed refresh token to be stored")
+		}
+	})
+}
+
+func TestRefreshSession(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should rotate the token and return the session user", func(t *testing.T) {
+		userID := uuid.New()
+		var lookedUp string
+		mockRepo := &MockRepository{
+			rotateRefreshFunc: func(ctx context.Context, tokenHash string, next *RefreshToken) (*Session, error) {
+				lookedUp = tokenHash
+				return &Session{ID: uuid.New(), UserID: userID}, nil
+			},
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				return &User{ID: id, Role: RoleClient}, nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		user, _, raw, err := s.RefreshSession(ctx, "old-token")
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		if lookedUp != auth.HashToken("old-token") {
+			t.Errorf("expected lookup by token hash")
+		}
+
+		if user.ID != userID || raw == "" || raw == "old-token" {
+			t.Errorf("expected new refresh token for user %s", userID)
+		}
+	})
+
+	t.Run("should surface refresh token reuse", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			rotateRefreshFunc: func(ctx context.Context, tokenHash string, next *RefreshToken) (*Session, error) {
+				return nil, ErrRefreshTokenReused
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		_, _, _, err := s.RefreshSession(ctx, "stolen")
+		if !errors.Is(err, ErrRefreshTokenReused) {
+			t.Errorf("expected ErrRefreshTokenReused, got: %v", err)
+		}
+	})
+}
+
+func TestSessionActive(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	sessions := map[string]*Session{
+		"active":  {UserID: userID, ExpiresAt: now.Add(time.Hour)},
+		"revoked": {UserID: userID, ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt},
+		"expired": {UserID: userID, ExpiresAt: now.Add(-time.Hour)},
+	}
+
+	for name, session := range sessions {
+		session.ID = uuid.New()
+		mockRepo := &MockRepository{
+			getSessionFunc: func(ctx context.Context, id uuid.UUID) (*Session, error) {
+				return session, nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		active, err := s.SessionActive(ctx, userID.String(), session.ID.String())
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got: %v", name, err)
+		}
+
+		if active != (name == "active") {
+			t.Errorf("%s: unexpected active state %v", name, active)
+		}
+	}
+
+	t.Run("should reject sessions of another user", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getSessionFunc: func(ctx context.Context, id uuid.UUID) (*Session, error) {
+				return sessions["active"], nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "http://localhost:3000")
+
+		active, _ := s.SessionActive(ctx, uuid.NewString(), sessions["active"].ID.String())
+		if active {
+			t.Error("expected session of another user to be rejected")
+		}
+	})
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should email a link whose token matches the stored hash", func(t *testing.T) {
+		user := &User{ID: uuid.New(), Name: "Eduardo", Email: "eduardo@email.com"}
+		var stored *PasswordResetToken
+
+		mockRepo := &MockRepository{
+			getUserByEmailFunc: func(ctx context.Context, email string) (*User, error) {
+				return user, nil
+			},
+			createResetFunc: func(ctx context.Context, token *PasswordResetToken) error {
+				stored = token
+				return nil
+			},
+		}
+		mockMailer := &MockMailer{}
+
+		s := NewUserService(mockRepo, &MockOrders{}, mockMailer, testSigner, "https://gastro.test/")
+
+		if err := s.RequestPasswordReset(ctx, user.Email); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		s.Close(ctx)
+
+		if stored == nil || stored.UserID != user.ID {
+			t.Fatalf("expected reset token for user, got %+v", stored)
+		}
+
+		if len(mockMailer.sent) != 1 || mockMailer.sent[0].To != user.Email {
+			t.Fatalf("expected one email to %s, got %+v", user.Email, mockMailer.sent)
+		}
+
+		_, raw, ok := strings.Cut(mockMailer.sent[0].Body, "https://gastro.test/reset-password?token=")
+		if !ok {
+			t.Fatalf("expected reset link in body, got %q", mockMailer.sent[0].Body)
+		}
+		raw, _, _ = strings.Cut(raw, "\n")
+
+		if auth.HashToken(raw) != stored.TokenHash {
+			t.Error("expected emailed token to match the stored hash")
+		}
+	})
+
+	t.Run("should silently ignore unknown emails", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getUserByEmailFunc: func(ctx context.Context, email string) (*User, error) {
+				return nil, ErrUserNotFound
+			},
+		}
+		mockMailer := &MockMailer{}
+
+		s := NewUserService(mockRepo, &MockOrders{}, mockMailer, testSigner, "https://gastro.test")
+
+		if err := s.RequestPasswordReset(ctx, "nobody@email.com"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		s.Close(ctx)
+
+		if len(mockMailer.sent) != 0 {
+			t.Errorf("expected no email, got %d", len(mockMailer.sent))
+		}
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should look the token up by hash", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			resetPasswordFunc: func(ctx context.Context, tokenHash, newHash string) error {
+				if tokenHash != auth.HashToken("raw-token") {
+					t.Errorf("expected hash of raw token, got %s", tokenHash)
+				}
+				return nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		if err := s.ResetPassword(ctx, "raw-token", "new-password"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("should return ErrInvalidResetToken from the repository", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			resetPasswordFunc: func(ctx context.Context, tokenHash, newHash string) error {
+				return ErrInvalidResetToken
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		err := s.ResetPassword(ctx, "raw-token", "new-password")
+		if !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("expected ErrInvalidResetToken, got: %v", err)
+		}
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+
+	sign := func(claims verificationClaims) string {
+		claims.Purpose = purposeVerifyEmail
+		payload, _ := json.Marshal(claims)
+		return testSigner.Sign(payload)
+	}
+
+	t.Run("should verify the email of the link", func(t *testing.T) {
+		userID := uuid.New()
+		verified := false
+
+		mockRepo := &MockRepository{
+			markVerifiedFunc: func(ctx context.Context, id uuid.UUID, email string) error {
+				verified = id == userID && email == "eduardo@email.com"
+				return nil
+			},
+		}
+
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		token := sign(verificationClaims{UserID: userID, Email: "eduardo@email.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		if err := s.VerifyEmail(ctx, token); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !verified {
+			t.Error("expected email to be verified")
+		}
+	})
+
+	t.Run("should reject expired links", func(t *testing.T) {
+		s := NewUserService(&MockRepository{}, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		token := sign(verificationClaims{UserID: uuid.New(), Email: "eduardo@email.com", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+		if err := s.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidVerification) {
+			t.Errorf("expected ErrInvalidVerification, got: %v", err)
+		}
+	})
+
+	t.Run("should reject links signed with another key", func(t *testing.T) {
+		s := NewUserService(&MockRepository{}, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		payload, _ := json.Marshal(verificationClaims{UserID: uuid.New(), Email: "eduardo@email.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		token := auth.NewSigner([]byte("another-key")).Sign(payload)
+
+		if err := s.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidVerification) {
+			t.Errorf("expected ErrInvalidVerification, got: %v", err)
+		}
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	ctx := context.Background()
+	user := &User{ID: uuid.New(), Name: "Eduardo", Email: "eduardo@email.com", Role: RoleClient}
+
+	t.Run("should send a new link", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				return user, nil
+			},
+		}
+		mockMailer := &MockMailer{}
+
+		s := NewUserService(mockRepo, &MockOrders{}, mockMailer, testSigner, "https://gastro.test")
+
+		if err := s.ResendVerification(ctx, user.ID); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if len(mockMailer.sent) != 1 || !strings.Contains(mockMailer.sent[0].Body, "https://gastro.test/verify-email?token=") {
+			t.Errorf("expected verification email, got %+v", mockMailer.sent)
+		}
+	})
+
+	t.Run("should throttle resends", func(t *testing.T) {
+		mockRepo := &MockRepository{
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				return user, nil
+			},
+			markSentFunc: func(ctx context.Context, id uuid.UUID, minInterval time.Duration) (bool, error) {
+				return false, nil
+			},
+		}
+		mockMailer := &MockMailer{}
+
+		s := NewUserService(mockRepo, &MockOrders{}, mockMailer, testSigner, "https://gastro.test")
+
+		if err := s.ResendVerification(ctx, user.ID); !errors.Is(err, ErrVerificationThrottled) {
+			t.Errorf("expected ErrVerificationThrottled, got: %v", err)
+		}
+
+		if len(mockMailer.sent) != 0 {
+			t.Errorf("expected no email, got %d", len(mockMailer.sent))
+		}
+	})
+}
+
+func TestCanPlaceOrder(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		user    *User
+		wantErr error
+	}{
+		{"verified client", &User{Role: RoleClient, EmailVerifiedAt: &now}, nil},
+		{"unverified client", &User{Role: RoleClient}, ErrEmailNotVerified},
+		{"unverified waiter", &User{Role: RoleWaiter}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockRepository{
+				getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+					return tt.user, nil
+				},
+			}
+
+			s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+			if err := s.CanPlaceOrder(ctx, uuid.New()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.MinCost)
+	user := &User{ID: uuid.New(), Email: "eduardo@email.com", PasswordHash: string(hash)}
+
+	newRepo := func() *MockRepository {
+		return &MockRepository{
+			getUserByEmailFunc: func(ctx context.Context, email string) (*User, error) {
+				if email == user.Email {
+					return user, nil
+				}
+				return nil, ErrUserNotFound
+			},
+		}
+	}
+
+	t.Run("should return the same error for unknown email and wrong password", func(t *testing.T) {
+		s := NewUserService(newRepo(), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		_, errUnknown := s.Authenticate(ctx, "nobody@email.com", "12345678", "203.0.113.7")
+		_, errWrong := s.Authenticate(ctx, user.Email, "wrong-password", "203.0.113.7")
+
+		if !errors.Is(errUnknown, ErrInvalidCredentials) || !errors.Is(errWrong, ErrInvalidCredentials) {
+			t.Errorf("expected ErrInvalidCredentials for both, got %v and %v", errUnknown, errWrong)
+		}
+	})
+
+	t.Run("should lock the account after too many failures", func(t *testing.T) {
+		mockRepo := newRepo()
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		var err error
+		for i := 0; i < accountFreeAttempts; i++ {
+			_, err = s.Authenticate(ctx, user.Email, "wrong-password", "203.0.113.7")
+		}
+
+		var locked *LoginLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("expected LoginLockedError, got: %v", err)
+		}
+
+		_, err = s.Authenticate(ctx, user.Email, "12345678", "203.0.113.7")
+		if !errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("expected ErrTooManyAttempts with the right password while locked, got: %v", err)
+		}
+
+		if err := s.ClearLockout(ctx, accountKey(user.Email)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if _, err := s.Authenticate(ctx, user.Email, "12345678", "203.0.113.7"); err != nil {
+			t.Errorf("expected login after clearing the lockout, got: %v", err)
+		}
+	})
+
+	t.Run("should reset the account counter on success", func(t *testing.T) {
+		mockRepo := newRepo()
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		s.Authenticate(ctx, user.Email, "wrong-password", "203.0.113.7")
+		if _, err := s.Authenticate(ctx, user.Email, "12345678", "203.0.113.7"); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if _, ok := mockRepo.throttles[accountKey(user.Email)]; ok {
+			t.Error("expected account counter to be cleared")
+		}
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	ctx := context.Background()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.MinCost)
+
+	newRepo := func() *MockRepository {
+		user := &User{ID: uuid.New(), Email: "eduardo@email.com", PasswordHash: string(hash)}
+		return &MockRepository{
+			totpUser: user,
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				snapshot := *user
+				return &snapshot, nil
+			},
+		}
+	}
+
+	// enroll enables two-factor authentication with the code of the
+	// previous time step, leaving the current one unused.
+	enroll := func(t *testing.T, s Service, repo *MockRepository) []string {
+		t.Helper()
+
+		secret, _, err := s.SetupTwoFactor(ctx, repo.totpUser.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now())-1)
+		recovery, err := s.EnableTwoFactor(ctx, repo.totpUser.ID, code)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		return recovery
+	}
+
+	t.Run("should reject enabling with a wrong code", func(t *testing.T) {
+		repo := newRepo()
+		s := NewUserService(repo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		if _, err := s.EnableTwoFactor(ctx, repo.totpUser.ID, "000000"); !errors.Is(err, ErrTwoFactorNotSetUp) {
+			t.Errorf("expected ErrTwoFactorNotSetUp before setup, got: %v", err)
+		}
+
+		secret, _, _ := s.SetupTwoFactor(ctx, repo.totpUser.ID)
+		code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+5)
+
+		if _, err := s.EnableTwoFactor(ctx, repo.totpUser.ID, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected ErrInvalidTwoFactorCode, got: %v", err)
+		}
+	})
+
+	t.Run("should complete a login challenge once per code", func(t *testing.T) {
+		repo := newRepo()
+		s := NewUserService(repo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		recovery := enroll(t, s, repo)
+		if len(recovery) != recoveryCodeCount {
+			t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery))
+		}
+
+		challenge, err := s.NewLoginChallenge(repo.totpUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _ := auth.TOTPCode(repo.totpUser.TOTPSecret, auth.TOTPStep(time.Now()))
+
+		if _, err := s.VerifyLoginChallenge(ctx, challenge, code); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if _, err := s.VerifyLoginChallenge(ctx, challenge, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected replayed code to be rejected, got: %v", err)
+		}
+
+		if _, err := s.VerifyLoginChallenge(ctx, challenge, strings.ToUpper(recovery[0])); err != nil {
+			t.Errorf("expected recovery code to be accepted, got: %v", err)
+		}
+
+		if _, err := s.VerifyLoginChallenge(ctx, challenge, recovery[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("expected used recovery code to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("should reject tampered or foreign challenges", func(t *testing.T) {
+		repo := newRepo()
+		s := NewUserService(repo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+		enroll(t, s, repo)
+
+		challenge, _ := s.NewLoginChallenge(repo.totpUser)
+		code, _ := auth.TOTPCode(repo.totpUser.TOTPSecret, auth.TOTPStep(time.Now()))
+
+		if _, err := s.VerifyLoginChallenge(ctx, challenge+"x", code); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("expected ErrInvalidChallenge for tampered challenge, got: %v", err)
+		}
+
+		payload, _ := json.Marshal(verificationClaims{UserID: repo.totpUser.ID, Purpose: purposeVerifyEmail, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		if _, err := s.VerifyLoginChallenge(ctx, testSigner.Sign(payload), code); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("expected ErrInvalidChallenge for an email verification token, got: %v", err)
+		}
+	})
+
+	t.Run("should lock the second factor after too many wrong codes", func(t *testing.T) {
+		repo := newRepo()
+		s := NewUserService(repo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+		enroll(t, s, repo)
+
+		challenge, _ := s.NewLoginChallenge(repo.totpUser)
+
+		var err error
+		for i := 0; i < accountFreeAttempts; i++ {
+			_, err = s.VerifyLoginChallenge(ctx, challenge, "0000-0000")
+		}
+
+		if !errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("expected ErrTooManyAttempts, got: %v", err)
+		}
+	})
+
+	t.Run("should require password and code to disable", func(t *testing.T) {
+		repo := newRepo()
+		s := NewUserService(repo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+		recovery := enroll(t, s, repo)
+
+		if err := s.DisableTwoFactor(ctx, repo.totpUser.ID, "wrong-password", recovery[0]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("expected ErrInvalidCredentials, got: %v", err)
+		}
+
+		if err := s.DisableTwoFactor(ctx, repo.totpUser.ID, "12345678", recovery[0]); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if repo.totpUser.TwoFactorEnabled() {
+			t.Error("expected two-factor authentication to be disabled")
+		}
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.MinCost)
+	newRepo := func(stored **User) *MockRepository {
+		return &MockRepository{
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				return &User{ID: id, Name: "Eduardo", Email: "eduardo@email.com", EmailVerifiedAt: &now, PasswordHash: string(hash)}, nil
+			},
+			updateProfileFunc: func(ctx context.Context, user *User) error {
+				*stored = user
+				return nil
+			},
+		}
+	}
+
+	t.Run("should only change the fields present", func(t *testing.T) {
+		var stored *User
+		mockMailer := &MockMailer{}
+		s := NewUserService(newRepo(&stored), &MockOrders{}, mockMailer, testSigner, "https://gastro.test")
+
+		phone := "+5511999999999"
+		_, err := s.UpdateProfile(ctx, uuid.New(), UpdateProfileRequest{Phone: &phone})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if stored.Name != "Eduardo" || stored.Phone != phone || !stored.EmailVerified() {
+			t.Errorf("unexpected stored user: %+v", stored)
+		}
+
+		if len(mockMailer.sent) != 0 {
+			t.Errorf("expected no email, got %d", len(mockMailer.sent))
+		}
+	})
+
+	t.Run("should verify a new email again", func(t *testing.T) {
+		var stored *User
+		mockMailer := &MockMailer{}
+		s := NewUserService(newRepo(&stored), &MockOrders{}, mockMailer, testSigner, "https://gastro.test")
+
+		email := "new@email.com"
+		_, err := s.UpdateProfile(ctx, uuid.New(), UpdateProfileRequest{Email: &email, CurrentPassword: "12345678"})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if stored.Email != email || stored.EmailVerified() {
+			t.Errorf("expected new unverified email, got: %+v", stored)
+		}
+
+		if len(mockMailer.sent) != 1 || mockMailer.sent[0].To != email {
+			t.Errorf("expected verification email to %s, got: %+v", email, mockMailer.sent)
+		}
+	})
+
+	t.Run("should require the current password to change the email", func(t *testing.T) {
+		var stored *User
+		s := NewUserService(newRepo(&stored), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		email := "new@email.com"
+		if _, err := s.UpdateProfile(ctx, uuid.New(), UpdateProfileRequest{Email: &email}); !errors.Is(err, ErrCurrentPasswordRequired) {
+			t.Errorf("expected ErrCurrentPasswordRequired, got: %v", err)
+		}
+
+		if _, err := s.UpdateProfile(ctx, uuid.New(), UpdateProfileRequest{Email: &email, CurrentPassword: "wrong-password"}); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("expected ErrInvalidCredentials, got: %v", err)
+		}
+
+		if stored != nil {
+			t.Errorf("expected no update, got: %+v", stored)
+		}
+	})
+
+	t.Run("should let admins change the email without a password", func(t *testing.T) {
+		var stored *User
+		s := NewUserService(newRepo(&stored), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		email := "new@email.com"
+		if _, err := s.UpdateUser(ctx, uuid.New(), UpdateProfileRequest{Email: &email}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if stored.Email != email {
+			t.Errorf("expected new email, got: %+v", stored)
+		}
+	})
+}
+
+func TestUpdateProfileRequestValidate(t *testing.T) {
+	phone := "11 99999-9999"
+	if err := (UpdateProfileRequest{Phone: &phone}).Validate(); err == nil {
+		t.Error("expected invalid phone to be rejected")
+	}
+
+	if err := (UpdateProfileRequest{Preferences: &Preferences{Language: "not a tag"}}).Validate(); err == nil {
+		t.Error("expected invalid language to be rejected")
+	}
+
+	empty := ""
+	if err := (UpdateProfileRequest{Phone: &empty, Preferences: &Preferences{Language: "pt-BR"}}).Validate(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+func TestCreateStaffRequestValidate(t *testing.T) {
+	req := CreateStaffRequest{Name: "Maria", Email: "maria@example.com", Password: "12345678"}
+
+	for _, role := range []Role{RoleClient, Role("root")} {
+		req.Role = role
+		if err := req.Validate(); err == nil {
+			t.Errorf("expected role %q to be rejected", role)
+		}
+	}
+
+	for _, role := range []Role{RoleAdmin, RoleManager, RoleKitchen, RoleWaiter, RoleCashier} {
+		req.Role = role
+		if err := req.Validate(); err != nil {
+			t.Errorf("expected role %q to be accepted, got: %v", role, err)
+		}
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.MinCost)
+
+	newRepo := func(deleted *bool) *MockRepository {
+		return &MockRepository{
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				return &User{ID: id, PasswordHash: string(hash)}, nil
+			},
+			deleteUserFunc: func(ctx context.Context, id uuid.UUID) error {
+				*deleted = true
+				return nil
+			},
+		}
+	}
+
+	t.Run("should require the password", func(t *testing.T) {
+		var deleted bool
+		s := NewUserService(newRepo(&deleted), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		err := s.DeleteAccount(ctx, uuid.New(), "wrong-password")
+		if !errors.Is(err, ErrInvalidCredentials) || deleted {
+			t.Errorf("expected ErrInvalidCredentials without deleting, got: %v", err)
+		}
+	})
+
+	t.Run("should refuse while orders are in progress", func(t *testing.T) {
+		var deleted bool
+		s := NewUserService(newRepo(&deleted), &MockOrders{open: true}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		err := s.DeleteAccount(ctx, uuid.New(), "12345678")
+		if !errors.Is(err, ErrOpenOrders) || deleted {
+			t.Errorf("expected ErrOpenOrders without deleting, got: %v", err)
+		}
+	})
+
+	t.Run("should delete the account", func(t *testing.T) {
+		var deleted bool
+		s := NewUserService(newRepo(&deleted), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		if err := s.DeleteAccount(ctx, uuid.New(), "12345678"); err != nil || !deleted {
+			t.Errorf("expected account to be deleted, got: %v", err)
+		}
+	})
+
+	t.Run("should not let admins delete themselves by id", func(t *testing.T) {
+		var deleted bool
+		s := NewUserService(newRepo(&deleted), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		id := uuid.New()
+		if err := s.DeleteUser(ctx, id, id); !errors.Is(err, ErrOwnAccount) || deleted {
+			t.Errorf("expected ErrOwnAccount without deleting, got: %v", err)
+		}
+	})
+}
+
+func TestQueryUsers(t *testing.T) {
+	ctx := context.Background()
+
+	var got QueryFilter
+	mockRepo := &MockRepository{
+		queryUsersFunc: func(ctx context.Context, filter QueryFilter) ([]User, int64, error) {
+			got = filter
+			return nil, 0, nil
+		},
+	}
+
+	s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+	if _, _, err := s.QueryUsers(ctx, QueryFilter{Role: Role("root")}); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("expected ErrInvalidRole, got: %v", err)
+	}
+
+	if _, _, err := s.QueryUsers(ctx, QueryFilter{Limit: 1000}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if got.Page != 1 || got.Limit != MaxPageLimit {
+		t.Errorf("expected normalized filter, got: %+v", got)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+
+	admin := &User{ID: uuid.New(), Role: RoleAdmin}
+	waiter := &User{ID: uuid.New(), Role: RoleWaiter}
+
+	newRepo := func() *MockRepository {
+		return &MockRepository{
+			getUserByIDFunc: func(ctx context.Context, id uuid.UUID) (*User, error) {
+				switch id {
+				case admin.ID:
+					return admin, nil
+				case waiter.ID:
+					return waiter, nil
+				}
+				return nil, ErrUserNotFound
+			},
+		}
+	}
+
+	t.Run("should only grant scopes of the owner's role", func(t *testing.T) {
+		s := NewUserService(newRepo(), &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		_, _, err := s.CreateAPIKey(ctx, admin.ID, CreateAPIKeyRequest{
+			Name:   "POS",
+			UserID: waiter.ID.String(),
+			Scopes: []string{string(rbac.PermOrderCreate), string(rbac.PermDishWrite)},
+		})
+		if !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("expected ErrInvalidScope for a scope the waiter lacks, got: %v", err)
+		}
+
+		_, _, err = s.CreateAPIKey(ctx, admin.ID, CreateAPIKeyRequest{
+			Name:   "Admin key",
+			Scopes: []string{string(rbac.PermUserManage)},
+		})
+		if !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("expected ErrInvalidScope for user management, got: %v", err)
+		}
+	})
+
+	t.Run("should resolve a key to its owner and scopes", func(t *testing.T) {
+		mockRepo := newRepo()
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		key, raw, err := s.CreateAPIKey(ctx, admin.ID, CreateAPIKeyRequest{
+			Name:   "POS",
+			UserID: waiter.ID.String(),
+			Scopes: []string{string(rbac.PermOrderCreate)},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !strings.HasPrefix(raw, key.Prefix+"_") || key.KeyHash != auth.HashToken(raw) {
+			t.Errorf("expected key %q to start with %q and be stored hashed", raw, key.Prefix)
+		}
+
+		principal, err := s.VerifyAPIKey(ctx, raw)
+		if err != nil || principal == nil {
+			t.Fatalf("expected key to verify, got: %v", err)
+		}
+
+		if principal.UserID != waiter.ID.String() || principal.Role != string(waiter.Role) ||
+			len(principal.Scopes) != 1 || principal.Scopes[0] != rbac.PermOrderCreate {
+			t.Errorf("unexpected principal: %+v", principal)
+		}
+
+		if mockRepo.apiKeys[key.KeyHash].LastUsedAt == nil {
+			t.Error("expected last use to be recorded")
+		}
+
+		if principal, _ := s.VerifyAPIKey(ctx, raw+"x"); principal != nil {
+			t.Error("expected unknown key to be rejected")
+		}
+	})
+
+	t.Run("should reject revoked and expired keys", func(t *testing.T) {
+		mockRepo := newRepo()
+		s := NewUserService(mockRepo, &MockOrders{}, &MockMailer{}, testSigner, "https://gastro.test")
+
+		scopes := []string{string(rbac.PermOrderCreate)}
+
+		revoked, rawRevoked, _ := s.CreateAPIKey(ctx, admin.ID, CreateAPIKeyRequest{Name: "Old POS", Scopes: scopes})
+		if err := s.RevokeAPIKey(ctx, revoked.ID); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		expiry := time.Now().Add(time.Hour)
+		expired, rawExpired, _ := s.CreateAPIKey(ctx, admin.ID, CreateAPIKeyRequest{Name: "Temp", Scopes: scopes, ExpiresAt: &expiry})
+		past := time.Now().Add(-time.Minute)
+		mockRepo.apiKeys[expired.KeyHash].ExpiresAt = &past
+
+		for _, raw := range []string{rawRevoked, rawExpired} {
+			if principal, err := s.VerifyAPIKey(ctx, raw); err != nil || principal != nil {
+				t.Errorf("expected key to be rejected, got: %+v, %v", principal, err)
+			}
+		}
+
+		if _, _, err := s.CreateAPIKey(ctx, admin.ID, CreateAPIKeyRequest{Name: "Temp", Scopes: scopes, ExpiresAt: &past}); !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("expected ErrInvalidExpiry, got: %v", err)
+		}
+	})
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{accountFreeAttempts - 1, 0},
+		{accountFreeAttempts, lockoutBase},
+		{accountFreeAttempts + 1, 2 * lockoutBase},
+		{accountFreeAttempts + 100, lockoutMax},
+	}
+
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.failures, accountFreeAttempts); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
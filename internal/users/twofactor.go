@@ -0,0 +1,254 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/EduardoMark/gastro-api/internal/auth"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// totpIssuer is the account issuer shown by authenticator apps.
+	totpIssuer = "Gastro API"
+
+	// LoginChallengeTTL is how long the second step of a two-factor login
+	// can be completed after the password was accepted.
+	LoginChallengeTTL = 5 * time.Minute
+
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp    = errors.New("two-factor authentication setup was not started")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+)
+
+const purposeLoginChallenge = "login_challenge"
+
+type challengeClaims struct {
+	UserID    uuid.UUID `json:"uid"`
+	Purpose   string    `json:"purpose"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+func mfaKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
+
+// SetupTwoFactor starts an enrollment by generating a new secret. The secret
+// is only used once EnableTwoFactor confirms a code from it.
+func (s *userService) SetupTwoFactor(ctx context.Context, userID uuid.UUID) (string, string, error) {
+	user, err := s.r.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if user.TwoFactorEnabled() {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.r.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		return "", "", err
+	}
+
+	return secret, auth.TOTPProvisioningURI(totpIssuer, user.Email, secret), nil
+}
+
+// EnableTwoFactor confirms the enrollment with a code from the authenticator
+// and returns the recovery codes, which are not retrievable afterwards.
+func (s *userService) EnableTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.r.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.r.EnableTOTP(ctx, user.ID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor requires both the password and a current code, so a stolen
+// session alone cannot turn the second factor off.
+func (s *userService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, password, code string) error {
+	user, err := s.r.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	return s.r.DisableTOTP(ctx, user.ID)
+}
+
+// NewLoginChallenge returns the token that proves the password step of a
+// two-factor login succeeded.
+func (s *userService) NewLoginChallenge(user *User) (string, error) {
+	payload, err := json.Marshal(challengeClaims{
+		UserID:    user.ID,
+		Purpose:   purposeLoginChallenge,
+		ExpiresAt: time.Now().Add(LoginChallengeTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.signer.Sign(payload), nil
+}
+
+// VerifyLoginChallenge completes a two-factor login with a TOTP or recovery
+// code. Wrong codes count towards a lockout of the account's second factor.
+func (s *userService) VerifyLoginChallenge(ctx context.Context, challenge, code string) (*User, error) {
+	payload, err := s.signer.Verify(challenge)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	var claims challengeClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	if claims.Purpose != purposeLoginChallenge || time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrInvalidChallenge
+	}
+
+	key := mfaKey(claims.UserID)
+
+	throttles, err := s.r.GetLoginThrottles(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, throttle := range throttles {
+		if throttle.Locked(time.Now()) {
+			return nil, &LoginLockedError{Until: *throttle.LockedUntil}
+		}
+	}
+
+	user, err := s.r.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled() {
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			return nil, err
+		}
+
+		if err := s.recordLoginFailure(ctx, []string{key}); !errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	if err := s.r.ClearLoginThrottle(ctx, key); err != nil && !errors.Is(err, ErrLockoutNotFound) {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// verifySecondFactor accepts a TOTP code, each time step only once, or an
+// unused recovery code.
+func (s *userService) verifySecondFactor(ctx context.Context, user *User, code string) error {
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		used, err := s.r.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.r.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns codes formatted as "xxxx-xxxx" with their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+		codes[i] = raw[:4] + "-" + raw[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case and dashes so codes can be typed loosely.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return auth.HashToken(code)
+}
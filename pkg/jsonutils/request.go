@@ -10,7 +10,7 @@ func DecodeJson[T any](r *http.Request) (T, error) {
 	var data T
 
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		return data, fmt.Errorf("failed decode json: %v", err)
+		return data, fmt.Errorf("failed decode json: %w", err)
 	}
 
 	return data, nil